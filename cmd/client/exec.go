@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+// errTimedOut is returned by runCmd when a command is killed for running
+// longer than its timeout
+var errTimedOut = errors.New("timed out")
+
+// waitDelay is how long runCmd waits for the rest of the output of a
+// command once it has exited. Output of processes it left behind that keep
+// the output pipe open beyond that is not waited for.
+const waitDelay = time.Second
+
+// runCmd runs the command and returns its combined output. If c.Timeout (in seconds)
+// is > 0 and the command does not finish in time, the whole process group is
+// killed and whatever output was captured so far is returned along with errTimedOut.
+func runCmd(c *command) ([]byte, error) {
+	// the command is given the pipe itself rather than a buffer, so that
+	// cmd.Wait returns when the process exits, not when everything that
+	// inherited the pipe has closed it
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	cmd := c.build()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	setProcessGroup(cmd)
+
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var out syncBuffer
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(&out, r)
+		close(copied)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if c.Timeout > 0 {
+		timer := time.NewTimer(time.Second * time.Duration(c.Timeout))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case err = <-done:
+	case <-timeout:
+		// kill the group and not just the process so that children
+		// (which might be holding the output pipe open) go away too
+		killProcessGroup(cmd)
+		<-done
+		err = errTimedOut
+	}
+
+	select {
+	case <-copied:
+	case <-time.After(waitDelay):
+	}
+	return out.Bytes(), err
+}
+
+// syncBuffer is a bytes.Buffer that can be written to while it's read
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+// Bytes returns a copy of what has been written so far
+func (s *syncBuffer) Bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.b.Bytes()...)
+}
+
+// severity maps the error returned by runCmd to an alert severity
+// following Nagios plugin conventions: exit code 1 is WARNING, 2 is CRITICAL
+// and everything else (3, other codes, timeouts, failure to start) is UNKNOWN.
+func severity(err error) proto.Severity {
+	if err == nil {
+		return proto.Severity_OK
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case 1:
+			return proto.Severity_WARNING
+		case 2:
+			return proto.Severity_CRITICAL
+		}
+	}
+	return proto.Severity_UNKNOWN
+}
+
+// build creates the exec.Cmd for c
+func (c *command) build() *exec.Cmd {
+	var cmd *exec.Cmd
+	if c.Shell {
+		// args are available to the script as $1, $2..
+		args := append([]string{"-c", c.Cmd, "sh"}, c.Args...)
+		cmd = exec.Command("/bin/sh", args...)
+	} else {
+		cmd = exec.Command(c.Cmd, c.Args...)
+	}
+	cmd.Dir = c.WorkDir
+
+	if c.InheritEnv == nil || *c.InheritEnv {
+		cmd.Env = os.Environ()
+	} else {
+		// non-nil so that exec does not fall back to the client's env
+		cmd.Env = []string{}
+	}
+	keys := make([]string, 0, len(c.Env))
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cmd.Env = append(cmd.Env, k+"="+c.Env[k])
+	}
+	return cmd
+}
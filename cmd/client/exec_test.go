@@ -0,0 +1,126 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+func TestRunCmdNotHeldUpByChildren(t *testing.T) {
+	cmds := []*command{
+		// exits, leaving a child with the output pipe behind
+		{Cmd: "echo started; sleep 30 &", Shell: true},
+	}
+	if _, err := exec.LookPath("setsid"); err == nil {
+		// killed on timeout, its child having left the process group
+		cmds = append(cmds, &command{Cmd: "echo started; setsid sleep 30 & sleep 30", Shell: true, Timeout: 1})
+	}
+	for _, c := range cmds {
+		start := time.Now()
+		out, err := runCmd(c)
+		if took := time.Since(start); took > time.Duration(c.Timeout)*time.Second+5*time.Second {
+			t.Errorf("%q: took %v", c.Cmd, took)
+		}
+		if c.Timeout > 0 && !errors.Is(err, errTimedOut) {
+			t.Errorf("%q: got %v, want errTimedOut", c.Cmd, err)
+		}
+		if !strings.Contains(string(out), "started") {
+			t.Errorf("%q: got output %q, want it to have started", c.Cmd, out)
+		}
+	}
+}
+
+func TestCommandBuild(t *testing.T) {
+	t.Setenv("WD_TEST_INHERITED", "client")
+	no := false
+	tests := []struct {
+		name string
+		c    *command
+		out  string
+		env  []string // what cmd.Env should end with
+	}{
+		{
+			name: "shell args",
+			c:    &command{Cmd: `echo "$0|$1|$2|$#"`, Args: []string{"a b", "c"}, Shell: true},
+			out:  "sh|a b|c|2\n",
+		},
+		{
+			name: "args not interpreted without shell",
+			c:    &command{Cmd: "echo", Args: []string{"$1", "a  b"}},
+			out:  "$1 a  b\n",
+		},
+		{
+			name: "inherited env",
+			c:    &command{Cmd: `echo "$WD_TEST_INHERITED"`, Shell: true},
+			out:  "client\n",
+		},
+		{
+			name: "configured env overrides inherited",
+			c: &command{Cmd: `echo "$WD_TEST_INHERITED $WD_TEST_A$WD_TEST_B"`, Shell: true,
+				Env: map[string]string{"WD_TEST_B": "2", "WD_TEST_INHERITED": "task", "WD_TEST_A": "1"}},
+			out: "task 12\n",
+			env: []string{"WD_TEST_A=1", "WD_TEST_B=2", "WD_TEST_INHERITED=task"},
+		},
+		{
+			name: "inheritEnv false",
+			c: &command{Cmd: `echo "[$WD_TEST_INHERITED] $WD_TEST_A"`, Shell: true,
+				Env: map[string]string{"WD_TEST_A": "1"}, InheritEnv: &no},
+			out: "[] 1\n",
+			env: []string{"WD_TEST_A=1"},
+		},
+		{
+			name: "inheritEnv false without env",
+			c:    &command{Cmd: `echo "[$WD_TEST_INHERITED]"`, Shell: true, InheritEnv: &no},
+			out:  "[]\n",
+			env:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		cmd := tt.c.build()
+		if tt.env != nil {
+			if tt.c.InheritEnv != nil && !*tt.c.InheritEnv && len(cmd.Env) != len(tt.env) {
+				t.Errorf("%s: got env %q, want only %q", tt.name, cmd.Env, tt.env)
+			} else if len(cmd.Env) < len(tt.env) || strings.Join(cmd.Env[len(cmd.Env)-len(tt.env):], " ") != strings.Join(tt.env, " ") {
+				t.Errorf("%s: got env %q, want it to end with %q", tt.name, cmd.Env, tt.env)
+			}
+		}
+
+		out, err := runCmd(tt.c)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(out) != tt.out {
+			t.Errorf("%s: got output %q, want %q", tt.name, out, tt.out)
+		}
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	tests := []struct {
+		c    *command
+		want proto.Severity
+	}{
+		{&command{Cmd: "exit 0", Shell: true}, proto.Severity_OK},
+		{&command{Cmd: "exit 1", Shell: true}, proto.Severity_WARNING},
+		{&command{Cmd: "exit 2", Shell: true}, proto.Severity_CRITICAL},
+		{&command{Cmd: "exit 3", Shell: true}, proto.Severity_UNKNOWN},
+		{&command{Cmd: "exit 42", Shell: true}, proto.Severity_UNKNOWN},
+		{&command{Cmd: "kill -9 $$", Shell: true}, proto.Severity_UNKNOWN},
+		{&command{Cmd: "sleep 30", Shell: true, Timeout: 1}, proto.Severity_UNKNOWN},
+		{&command{Cmd: "/nonexistent/wd-check"}, proto.Severity_UNKNOWN},
+	}
+	for _, tt := range tests {
+		_, err := runCmd(tt.c)
+		if got := severity(err); got != tt.want {
+			t.Errorf("%q: got %v (error %v), want %v", tt.c.Cmd, got, err, tt.want)
+		}
+	}
+}
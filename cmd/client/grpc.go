@@ -2,10 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/opxyc/wd/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 // GC is a gRPC client handle
@@ -14,11 +20,19 @@ type GC struct {
 }
 
 // New returns a gRPC Client handle that can be used to
-// start a grpc server and send msgs.
-func grpcCon(addr string) (*GC, error) {
+// start a grpc server and send msgs. If tlsCfg is nil, the
+// connection is not encrypted. token, if given, is sent with every msg.
+func grpcCon(addr string, tlsCfg *tls.Config, token string) (*GC, error) {
 	gc := &GC{}
 
-	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if tlsCfg != nil {
+		opts[0] = grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg))
+	}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCreds{token, tlsCfg != nil}))
+	}
+	conn, err := grpc.Dial(addr, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -26,13 +40,94 @@ func grpcCon(addr string) (*GC, error) {
 	return gc, nil
 }
 
-// send sends a message to gRPC server
-func (gc *GC) send(id, hostname, taskName, title, short, long string, status int32) error {
-	_, err := gc.client.SendAlert(context.Background(), &proto.Alert{
-		Id:     id,
-		From:   &proto.From{Hostname: hostname, TaskName: taskName},
-		Msg:    &proto.Msg{Short: short, Long: long, Time: time.Now().Format("2006-Jan-02 15:04:05")},
-		Status: status,
-	})
+// tokenCreds sends the token the client authenticates with
+type tokenCreds struct {
+	token  string
+	secure bool // whether the connection is encrypted
+}
+
+func (c tokenCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+func (c tokenCreds) RequireTransportSecurity() bool {
+	return c.secure
+}
+
+// readToken reads the token from file, ignoring surrounding whitespace
+func readToken(file string) (string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", file)
+	}
+	return token, nil
+}
+
+// clientTLS creates the TLS config for connecting to the server. Server
+// certificate is verified against caFile, or the system roots if it's empty.
+// certFile and keyFile, if given, are presented to the server, which can
+// require them (mutual TLS).
+func clientTLS(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		b, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// send sends an alert to gRPC server
+func (gc *GC) send(a *proto.Alert) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := gc.client.SendAlert(ctx, a)
+	return err
+}
+
+// sendHeartbeat sends a heartbeat to gRPC server
+func (gc *GC) sendHeartbeat(hb *proto.Heartbeat) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := gc.client.SendHeartbeat(ctx, hb)
 	return err
 }
+
+// sendResults sends results of task runs to gRPC server
+func (gc *GC) sendResults(r *proto.Results) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := gc.client.SendResults(ctx, r)
+	return err
+}
+
+// newAlert creates an alert from task t
+func newAlert(id string, t *task, short, long string, status proto.Status, sev proto.Severity) *proto.Alert {
+	return &proto.Alert{
+		Id:       id,
+		From:     &proto.From{Hostname: hostname, TaskName: t.Name},
+		Msg:      &proto.Msg{Short: short, Long: long, Time: time.Now().Format("2006-Jan-02 15:04:05")},
+		Status:   status,
+		Severity: sev,
+		Labels:   t.Labels,
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+// version of the client; set at build time with
+// -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// heartbeat sends a heartbeat to the server every interval until ctx is
+// done, so that the server can tell if the client has gone silent.
+// Heartbeats that could not be sent are not retried; the next one will do.
+func heartbeat(ctx context.Context, interval time.Duration, c *cfg) {
+	hb := &proto.Heartbeat{
+		Hostname:       hostname,
+		Version:        version,
+		Interval:       int64(interval / time.Second),
+		ConfigChecksum: checksum(c),
+	}
+	for _, t := range c.Tasks {
+		info := &proto.TaskInfo{Name: t.Name, Schedule: t.Schedule}
+		if t.Schedule == "" {
+			info.Interval = t.Interval
+		}
+		hb.Tasks = append(hb.Tasks, info)
+	}
+
+	var failing bool
+	for {
+		err := gc.sendHeartbeat(hb)
+		if err != nil && !failing {
+			sl.Printf("could not send heartbeat to server: %v", err)
+		} else if err == nil && failing {
+			sl.Printf("sending heartbeats to server again")
+		}
+		failing = err != nil
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// checksum returns the SHA-256 of c as read from the config file, so that
+// hosts running different configs can be told apart on the server
+func checksum(c *cfg) string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
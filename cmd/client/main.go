@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
-	"os/exec"
 	"os/signal"
 	"strings"
 	"syscall"
@@ -23,15 +25,31 @@ var (
 	addr     = flag.String("r", "localhost:40090", "server address in the format IP:PORT")
 	sDir     = flag.String("sl", "log/self", "client specific log directory")
 	tDir     = flag.String("tl", "log/task", "task execution log directory")
+	spDir    = flag.String("spool", "spool", "directory to keep alerts that could not be sent to server; empty to disable")
+	spSize   = flag.Int64("spool-max-size", 100, "max size of spool directory in MB")
+	spAge    = flag.Duration("spool-max-age", 24*time.Hour, "spooled alerts older than this are dropped")
+	mFile    = flag.String("m", "maintenance", "path to maintenance file; while it exists, failures are not alerted and actions are not run")
+	hbInt    = flag.Duration("hb", 30*time.Second, "interval at which heartbeats are sent to server; 0 to disable")
+	resInt   = flag.Duration("results", 0, "interval at which results of all task runs are sent to server; 0 to disable")
+	tknFile  = flag.String("token-file", "", "path to file with the token to authenticate to server with")
+	tlsOn    = flag.Bool("tls", false, "connect to server over TLS; implied by the other -tls flags")
+	tlsCA    = flag.String("tls-ca", "", "path to CA certificate(s) to verify server certificate with; system roots are used if not given")
+	tlsCert  = flag.String("tls-cert", "", "path to client certificate, for servers that require one; its CN should be the hostname of the client")
+	tlsKey   = flag.String("tls-key", "", "path to key of client certificate")
+	tlsName  = flag.String("tls-server-name", "", "name expected in server certificate; defaults to host in -r")
 	sl       *log.Logger          // self logger - for logging client specific stuff
 	tl       *log.Logger          // task execution logger
 	client   proto.WatchdogClient // grpc client
 	gc       *GC                  // grpc client
+	ob       *outbox              // sends alerts to server via gc, spooling them if required
 	hostname string               // system hostname
 )
 
 func main() {
 	flag.Parse()
+	if *hbInt > 0 && *hbInt < time.Second {
+		log.Fatalf("heartbeat interval should be at least 1s")
+	}
 
 	// set up loggers
 	// ---------------------------
@@ -52,10 +70,34 @@ func main() {
 	// ------------------------------
 
 	// register gRPC client
-	gc, err = grpcCon(*addr)
+	var tlsCfg *tls.Config
+	if *tlsOn || *tlsCA != "" || *tlsCert != "" || *tlsKey != "" || *tlsName != "" {
+		tlsCfg, err = clientTLS(*tlsCA, *tlsCert, *tlsKey, *tlsName)
+		if err != nil {
+			sl.Fatalf("could not set up TLS: %v", err)
+		}
+	}
+	var token string
+	if *tknFile != "" {
+		if token, err = readToken(*tknFile); err != nil {
+			sl.Fatalf("could not read token: %v", err)
+		}
+		if tlsCfg == nil {
+			sl.Printf("warning: token is sent to server unencrypted; use -tls")
+		}
+	}
+	gc, err = grpcCon(*addr, tlsCfg, token)
 	if err != nil {
 		sl.Fatalf("could not start gRPC client: %v", err)
 	}
+	ob, err = newOutbox(gc, *spDir, *spSize*1024*1024, *spAge)
+	if err != nil {
+		sl.Fatalf("could not set up spool directory: %v", err)
+	}
+	go ob.replay(ctx)
+
+	// used for jitter; different clients should not end up with the same delays
+	rand.Seed(time.Now().UnixNano())
 
 	// read cfg file
 	cfg := readFromCfg(*cfgF)
@@ -66,6 +108,15 @@ func main() {
 
 	sl.Printf("client (%s) started\n", hostname)
 
+	if *hbInt > 0 {
+		go heartbeat(ctx, *hbInt, cfg)
+	}
+	if *resInt > 0 {
+		results = &resultBatcher{}
+		go results.run(ctx, *resInt)
+	}
+	go watchMaintenance(ctx)
+
 	// execute tasks
 	for _, t := range cfg.Tasks {
 		go func(t task) {
@@ -82,59 +133,110 @@ func main() {
 	log.Println("done")
 }
 
-// execute executes a given task repetely according to the interval mentioned
+// execute executes a given task repetely according to the interval or schedule mentioned
 func execute(ctx context.Context, t *task) string {
+	st := &taskState{t: t}
+
+	runNow := t.RunOnStart
+
 	for {
+		// next run is scheduled from the end of the previous one
+		wait := t.next(time.Now())
+		if runNow {
+			wait, runNow = jitter(t.Jitter), false
+		}
+
 		select {
 		case <-ctx.Done():
 			return t.Name
-		case <-time.After(time.Second * time.Duration(t.Interval)):
+		case <-time.After(wait):
 			id := shortuuid.New()
 			var sb strings.Builder
 			var op string
 			mlog(tl, t.Name, nil, "", fmt.Sprintf("starting with ID %v", id))
 			sb.WriteString(op)
 
-			errOp, err := run(t)
+			start := time.Now()
+			out, errOp, err := run(t)
+			metrics := parseMetrics(out)
+			results.add(t, start, err, metrics)
 
 			if err == nil {
 				mlog(tl, t.Name, nil, "", "completed successfully")
+				if failedID := st.passed(); failedID != "" {
+					// task was failing till now; let the server know it's fine
+					a := newAlert(id, t, "resolved: "+t.Msg, "", proto.Status_RESOLVED, proto.Severity_OK)
+					a.RefId = failedID
+					a.Metrics = metrics
+					if err := ob.send(a); err != nil {
+						sl.Printf("could not send msg to server: %v", err)
+					}
+					mlog(tl, t.Name, nil, "", fmt.Sprintf("resolved alert %v", failedID))
+				}
 				continue
 			}
 
 			// error has occured...
-			// set status to 1
-			var status int32 = 1
 			sb.WriteString(errOp)
-
-			// execute actions if any
-			if len(t.Actions) > 0 {
-				errOp, errorOccured := runActions(t, err)
-				// errOp != nil means anyone of the actions failed
-				sb.WriteString(*errOp)
-				if !errorOccured {
-					// actions were taken and situation is handled.
-					// so set status to 0
-					status = 0
-				}
-			}
-			err = gc.send(id, hostname, t.Name, t.Name, t.Msg, sb.String(), status)
-			if err != nil {
-				sl.Printf("could not send msg to server: %v", err)
-			}
-			mlog(tl, t.Name, nil, "", fmt.Sprintf("completed with status %v", status))
+			handleFailure(t, st, id, err, &sb, metrics)
 		}
 	}
 }
 
-// run runs a command and retuns the err and output in errOp
-func run(t *task) (errOp string, err error) {
-	cmd := exec.Command(t.Cmd)
+// handleFailure runs the actions of t, which failed with err, and alerts
+// the server if the failure is confirmed. Actions are run on every failure,
+// so that they can fix the problem before it's alerted. sb has the output
+// of t so far.
+func handleFailure(t *task, st *taskState, id string, err error, sb *strings.Builder, metrics []*proto.Metric) {
+	// failures during maintenance are expected, so they are not
+	// counted towards an alert either
+	if inMaintenance() {
+		mlog(tl, t.Name, nil, "", "in maintenance mode, not alerting")
+		return
+	}
+	alert := st.failed(time.Now())
+
+	// set status to failed
+	status := proto.Status_FAILED
+	short := t.Msg
+	sev := severity(err)
+
+	if errors.Is(err, errTimedOut) {
+		// the check never finished, so we don't know whether the
+		// actions are needed; just report the timeout along with
+		// whatever output we got so far
+		short = fmt.Sprintf("task timed out after %ds: %s", t.Timeout, t.Msg)
+	} else if len(t.Actions) > 0 {
+		// execute actions if any
+		errOp, errorOccured := runActions(t, err)
+		// errOp != nil means anyone of the actions failed
+		sb.WriteString(*errOp)
+		if !errorOccured {
+			// actions were taken and situation is handled.
+			// so set status to handled
+			status = proto.Status_HANDLED
+		}
+	}
+
+	if !alert {
+		mlog(tl, t.Name, nil, "", fmt.Sprintf("failed %d time(s) in a row, not alerting", st.failures))
+		return
+	}
+	a := newAlert(id, t, short, sb.String(), status, sev)
+	a.Metrics = metrics
+	if err := ob.send(a); err != nil {
+		sl.Printf("could not send msg to server: %v", err)
+	}
+	st.alerted(id, time.Now())
+	mlog(tl, t.Name, nil, "", fmt.Sprintf("completed with status %v, severity %v", status, sev))
+}
 
-	out, err := cmd.CombinedOutput()
+// run runs a command and retuns its output, and the err and output in errOp
+func run(t *task) (out []byte, errOp string, err error) {
+	out, err = runCmd(&t.command)
 	if err != nil {
 		errOp := mlog(tl, t.Name, err, string(out), "")
-		return errOp, err
+		return out, errOp, err
 	}
 
 	return
@@ -149,8 +251,7 @@ func runActions(t *task, err error) (*string, bool) {
 	var errorOccured bool
 	// execute actions serially
 	for _, actn := range t.Actions {
-		cmd := exec.Command(actn.Cmd)
-		op, err := cmd.CombinedOutput()
+		op, err := runCmd(&actn.command)
 		// if no errors continue
 		if err != nil {
 			errorOccured = true
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opxyc/wd/proto"
+	"google.golang.org/grpc"
+)
+
+func TestMain(m *testing.M) {
+	sl = log.New(io.Discard, "", 0)
+	tl = log.New(io.Discard, "", 0)
+	hostname = "test-host"
+	os.Exit(m.Run())
+}
+
+var errDown = errors.New("server down")
+
+// fakeServer records what the client sends. Requests are recorded even
+// if they fail, as if the server got them but the client could not
+// confirm that.
+type fakeServer struct {
+	proto.WatchdogClient
+	mu      sync.Mutex
+	down    bool
+	block   chan struct{} // if not nil, alerts are not taken till it's closed
+	waiting chan struct{} // signalled when an alert waits on block
+	alerts  []*proto.Alert
+	results []*proto.Results
+}
+
+// useFakeServer makes gc send to a new fakeServer for the duration of the test
+func useFakeServer(t *testing.T) *fakeServer {
+	f := &fakeServer{}
+	old := gc
+	gc = &GC{client: f}
+	t.Cleanup(func() { gc = old })
+	return f
+}
+
+func (f *fakeServer) setDown(down bool) {
+	f.mu.Lock()
+	f.down = down
+	f.mu.Unlock()
+}
+
+func (f *fakeServer) SendAlert(ctx context.Context, a *proto.Alert, opts ...grpc.CallOption) (*proto.Void, error) {
+	f.mu.Lock()
+	block := f.block
+	f.mu.Unlock()
+	if block != nil {
+		f.waiting <- struct{}{}
+		<-block
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return nil, errDown
+	}
+	f.alerts = append(f.alerts, a)
+	return &proto.Void{}, nil
+}
+
+func (f *fakeServer) SendResults(ctx context.Context, r *proto.Results, opts ...grpc.CallOption) (*proto.Void, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results = append(f.results, r)
+	if f.down {
+		return nil, errDown
+	}
+	return &proto.Void{}, nil
+}
+
+// useOutbox makes ob send straight to gc for the duration of the test
+func useOutbox(t *testing.T) {
+	old := ob
+	ob = &outbox{gc: gc}
+	t.Cleanup(func() { ob = old })
+}
+
+// actionTask returns a task whose action appends a line to a file, and
+// the file
+func actionTask(t *testing.T) (*task, string) {
+	f := filepath.Join(t.TempDir(), "actions")
+	return &task{
+		Name:                "flaky",
+		Msg:                 "flaky failed",
+		FailuresBeforeAlert: 3,
+		Actions:             []action{{Name: "fix", command: command{Cmd: "echo ran >> " + f, Shell: true}}},
+	}, f
+}
+
+func actionRuns(t *testing.T, f string) int {
+	b, err := os.ReadFile(f)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(b), "ran")
+}
+
+func TestActionsRunOnUnconfirmedFailures(t *testing.T) {
+	srv := useFakeServer(t)
+	useOutbox(t)
+	tk, f := actionTask(t)
+	st := &taskState{t: tk}
+
+	for i := 1; i <= 3; i++ {
+		handleFailure(tk, st, fmt.Sprint(i), errors.New("exit status 1"), &strings.Builder{}, nil)
+		if got := actionRuns(t, f); got != i {
+			t.Errorf("failure %d: actions ran %d time(s), want %d", i, got, i)
+		}
+	}
+	if len(srv.alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1 after failuresBeforeAlert", len(srv.alerts))
+	}
+	if a := srv.alerts[0]; a.Id != "3" || a.Status != proto.Status_HANDLED {
+		t.Errorf("got alert %s with status %v, want 3 with HANDLED", a.Id, a.Status)
+	}
+}
+
+func TestMaintenanceFailuresNotCounted(t *testing.T) {
+	srv := useFakeServer(t)
+	useOutbox(t)
+	tk, f := actionTask(t)
+	st := &taskState{t: tk}
+
+	prev := *mFile
+	*mFile = filepath.Join(t.TempDir(), "maintenance")
+	t.Cleanup(func() { *mFile = prev })
+
+	if err := setMaintenance(true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		handleFailure(tk, st, fmt.Sprint(i), errors.New("exit status 1"), &strings.Builder{}, nil)
+	}
+	if st.failures != 0 || actionRuns(t, f) != 0 || len(srv.alerts) != 0 {
+		t.Fatalf("in maintenance: got %d failures, %d action runs, %d alerts; want none", st.failures, actionRuns(t, f), len(srv.alerts))
+	}
+
+	if err := setMaintenance(false); err != nil {
+		t.Fatal(err)
+	}
+	handleFailure(tk, st, "4", errors.New("exit status 1"), &strings.Builder{}, nil)
+	if st.failures != 1 || len(srv.alerts) != 0 {
+		t.Errorf("after maintenance: got %d failures, %d alerts; want 1 failure, no alerts", st.failures, len(srv.alerts))
+	}
+}
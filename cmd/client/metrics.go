@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/opxyc/wd/proto"
+)
+
+// parseMetrics finds metrics in the output of a task. Two forms are understood:
+//   - Nagios perfdata after a "|" on a line, as space separated
+//     'label'=value[UOM];[warn];[crit];[min];[max]
+//   - a line with a JSON object like {"metrics": {"name": 1.5, ...}}
+//
+// Anything that does not parse is ignored.
+func parseMetrics(out []byte) []*proto.Metric {
+	var metrics []*proto.Metric
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "{") {
+			metrics = append(metrics, jsonMetrics(line)...)
+			continue
+		}
+		if i := strings.Index(line, "|"); i >= 0 {
+			metrics = append(metrics, perfdata(line[i+1:])...)
+		}
+	}
+	return metrics
+}
+
+// jsonMetrics parses a line like {"metrics": {"name": 1.5}}
+func jsonMetrics(line string) []*proto.Metric {
+	var v struct {
+		Metrics map[string]float64 `json:"metrics"`
+	}
+	if err := json.Unmarshal([]byte(line), &v); err != nil {
+		return nil
+	}
+	var metrics []*proto.Metric
+	for name, value := range v.Metrics {
+		metrics = append(metrics, &proto.Metric{Name: name, Value: value})
+	}
+	return metrics
+}
+
+// perfdata parses Nagios performance data
+func perfdata(s string) []*proto.Metric {
+	var metrics []*proto.Metric
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		// label, which is quoted if it has spaces
+		var label string
+		if s[0] == '\'' {
+			end := strings.Index(s[1:], "'=")
+			if end < 0 {
+				return metrics
+			}
+			label, s = strings.ReplaceAll(s[1:end+1], "''", "'"), s[end+3:]
+		} else {
+			eq := strings.IndexByte(s, '=')
+			if eq < 0 {
+				return metrics
+			}
+			label, s = s[:eq], s[eq+1:]
+			if strings.ContainsAny(label, " \t") {
+				// not perfdata after all; skip to the next word
+				label = label[strings.LastIndexAny(label, " \t")+1:]
+			}
+		}
+
+		var data string
+		if sp := strings.IndexAny(s, " \t"); sp >= 0 {
+			data, s = s[:sp], s[sp:]
+		} else {
+			data, s = s, ""
+		}
+
+		// value and unit are before the first ';'
+		if semi := strings.IndexByte(data, ';'); semi >= 0 {
+			data = data[:semi]
+		}
+		n := strings.IndexFunc(data, func(r rune) bool {
+			return !strings.ContainsRune("0123456789.-+eE", r)
+		})
+		if n < 0 {
+			n = len(data)
+		}
+		value, err := strconv.ParseFloat(data[:n], 64)
+		if label == "" || err != nil {
+			// eg. value "U", which means it could not be determined
+			continue
+		}
+		metrics = append(metrics, &proto.Metric{Name: label, Value: value, Unit: data[n:]})
+	}
+	return metrics
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseMetrics(t *testing.T) {
+	tests := []struct {
+		out  string
+		want []string // name=value unit, sorted
+	}{
+		{out: "", want: nil},
+		{out: "OK - all fine", want: nil},
+		{out: "OK - load is fine | load1=0.5", want: []string{"load1=0.5 "}},
+		{out: "DISK OK | /=2643MB;5948;5958;0;5968 /boot=68MB", want: []string{"/=2643 MB", "/boot=68 MB"}},
+		{out: "OK | time=0.021s;1;2 size=512B;;;0 used=87.5%", want: []string{"size=512 B", "time=0.021 s", "used=87.5 %"}},
+		{out: "OK | 'disk usage'=45%;80;90 'it''s'=3", want: []string{"disk usage=45 %", "it's=3 "}},
+		{out: "UNKNOWN | rtt=U;100;200 loss=0%", want: []string{"loss=0 %"}},
+		{out: "OK | temp=-4.5C", want: []string{"temp=-4.5 C"}},
+		{out: "OK | a=1 junk b=2", want: []string{"a=1 ", "b=2 "}},
+		{out: "OK | 'unterminated=1", want: nil},
+		{out: "line one\nline two | x=1\n| y=2c", want: []string{"x=1 ", "y=2 c"}},
+		{out: `{"metrics": {"queue": 12, "lag": 0.25}}`, want: []string{"lag=0.25 ", "queue=12 "}},
+		{out: `  {"metrics": {"queue": 1}}` + "\nOK | z=3", want: []string{"queue=1 ", "z=3 "}},
+		{out: `{"metrics": {"queue": "many"}}`, want: nil},
+		{out: `{not json | w=1`, want: nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range parseMetrics([]byte(tt.out)) {
+			got = append(got, fmt.Sprintf("%s=%v %s", m.Name, m.Value, m.Unit))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
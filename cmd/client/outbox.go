@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+	pb "google.golang.org/protobuf/proto"
+)
+
+const (
+	spoolExt       = ".alert"
+	minReplayDelay = time.Second
+	maxReplayDelay = time.Minute
+)
+
+// outbox sends alerts to the server. Alerts that could not be sent are
+// spooled to dir and replayed in the order they were generated once the
+// server is reachable again.
+type outbox struct {
+	gc       *GC
+	dir      string
+	maxBytes int64         // max total size of spooled alerts
+	maxAge   time.Duration // spooled alerts older than this are dropped
+	// guards the spool dir. It's not held while sending, so that a slow
+	// server does not hold up tasks that have alerts to spool.
+	mu   sync.Mutex
+	kick chan struct{}
+}
+
+// newOutbox creates an outbox that spools to dir. If dir is empty,
+// alerts are not spooled and are lost if they could not be sent.
+func newOutbox(gc *GC, dir string, maxBytes int64, maxAge time.Duration) (*outbox, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &outbox{
+		gc:       gc,
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		kick:     make(chan struct{}, 1),
+	}, nil
+}
+
+// send sends a to the server. If it could not be sent, or if there are
+// older alerts waiting in the spool, a is spooled instead.
+// It returns error only if a could neither be sent nor spooled.
+func (o *outbox) send(a *proto.Alert) error {
+	if o.dir == "" {
+		return o.gc.send(a)
+	}
+
+	o.mu.Lock()
+	files, err := o.files()
+	o.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		err := o.gc.send(a)
+		if err == nil {
+			return nil
+		}
+		sl.Printf("could not send msg %s to server, spooling it: %v", a.Id, err)
+	}
+
+	o.mu.Lock()
+	err = o.spool(a)
+	o.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	select {
+	case o.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// replay sends the spooled alerts to the server until ctx is done.
+// On failure, it backs off exponentially up to maxReplayDelay.
+func (o *outbox) replay(ctx context.Context) {
+	if o.dir == "" {
+		return
+	}
+
+	delay := minReplayDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.kick:
+		case <-time.After(delay):
+		}
+
+		n, err := o.flush()
+		if err != nil {
+			sl.Printf("could not replay spooled alerts, will retry in %v: %v", delay, err)
+			if delay *= 2; delay > maxReplayDelay {
+				delay = maxReplayDelay
+			}
+			continue
+		}
+		if n > 0 {
+			sl.Printf("replayed %d spooled alert(s)", n)
+		}
+		delay = minReplayDelay
+	}
+}
+
+// flush sends spooled alerts in order, stopping at the first failure.
+// It returns the number of alerts sent. Only replay calls it, so spooled
+// alerts are removed only here and by prune.
+func (o *outbox) flush() (int, error) {
+	o.mu.Lock()
+	files, err := o.files()
+	o.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if os.IsNotExist(err) {
+			// dropped by prune meanwhile
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		a := &proto.Alert{}
+		if err := pb.Unmarshal(b, a); err != nil {
+			// nothing we can do about it
+			sl.Printf("dropping corrupt spooled alert %s: %v", f, err)
+			os.Remove(f)
+			continue
+		}
+		if err := o.gc.send(a); err != nil {
+			return n, err
+		}
+		os.Remove(f)
+		n++
+	}
+	return n, nil
+}
+
+// spool writes a to the spool dir and enforces the size and age limits
+func (o *outbox) spool(a *proto.Alert) error {
+	b, err := pb.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	// file names sort in the order in which alerts were spooled
+	name := fmt.Sprintf("%020d-%s%s", time.Now().UnixNano(), a.Id, spoolExt)
+	tmp := filepath.Join(o.dir, "."+name)
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(o.dir, name)); err != nil {
+		return err
+	}
+
+	o.prune()
+	return nil
+}
+
+// prune drops spooled alerts that are older than maxAge and, if the spool
+// is still larger than maxBytes, the oldest ones until it fits.
+func (o *outbox) prune() {
+	files, err := o.files()
+	if err != nil {
+		sl.Printf("could not read spool dir: %v", err)
+		return
+	}
+
+	type entry struct {
+		path string
+		size int64
+	}
+	var (
+		kept  []entry
+		total int64
+	)
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if o.maxAge > 0 && time.Since(fi.ModTime()) > o.maxAge {
+			sl.Printf("dropping spooled alert %s: older than %v", filepath.Base(f), o.maxAge)
+			os.Remove(f)
+			continue
+		}
+		kept = append(kept, entry{f, fi.Size()})
+		total += fi.Size()
+	}
+
+	for i := 0; o.maxBytes > 0 && total > o.maxBytes && i < len(kept); i++ {
+		sl.Printf("dropping spooled alert %s: spool larger than %d bytes", filepath.Base(kept[i].path), o.maxBytes)
+		os.Remove(kept[i].path)
+		total -= kept[i].size
+	}
+}
+
+// files returns the spooled alerts, oldest first
+func (o *outbox) files() ([]string, error) {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || filepath.Ext(e.Name()) != spoolExt {
+			continue
+		}
+		files = append(files, filepath.Join(o.dir, e.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
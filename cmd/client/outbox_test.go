@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+func newTestOutbox(t *testing.T) *outbox {
+	t.Helper()
+	o, err := newOutbox(gc, t.TempDir(), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestOutboxSpoolsAndReplaysInOrder(t *testing.T) {
+	srv := useFakeServer(t)
+	o := newTestOutbox(t)
+
+	srv.setDown(true)
+	for _, id := range []string{"1", "2"} {
+		if err := o.send(&proto.Alert{Id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.setDown(false)
+	// spooled alerts go first, so this one is spooled too
+	if err := o.send(&proto.Alert{Id: "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.alerts) != 0 {
+		t.Fatalf("got %d alerts sent before replay, want 0", len(srv.alerts))
+	}
+
+	n, err := o.flush()
+	if err != nil || n != 3 {
+		t.Fatalf("flush: got %d, %v; want 3", n, err)
+	}
+	for i, a := range srv.alerts {
+		if want := []string{"1", "2", "3"}[i]; a.Id != want {
+			t.Errorf("alert %d: got %s, want %s", i, a.Id, want)
+		}
+	}
+	if files, _ := o.files(); len(files) != 0 {
+		t.Errorf("got %d alerts left in spool, want 0", len(files))
+	}
+}
+
+func TestOutboxNotHeldUpBySlowServer(t *testing.T) {
+	srv := useFakeServer(t)
+	o := newTestOutbox(t)
+
+	srv.setDown(true)
+	o.send(&proto.Alert{Id: "1"})
+	srv.setDown(false)
+
+	block := make(chan struct{})
+	srv.mu.Lock()
+	srv.block, srv.waiting = block, make(chan struct{}, 1)
+	srv.mu.Unlock()
+	flushed := make(chan struct{})
+	go func() {
+		o.flush()
+		close(flushed)
+	}()
+	<-srv.waiting
+
+	// while replay waits on the server, other alerts are spooled right away
+	sent := make(chan error)
+	go func() { sent <- o.send(&proto.Alert{Id: "2"}) }()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("send waited for replay to finish")
+	}
+
+	close(block)
+	<-flushed
+	if n, err := o.flush(); err != nil || n != 1 {
+		t.Fatalf("second flush: got %d, %v; want 1", n, err)
+	}
+	if len(srv.alerts) != 2 || srv.alerts[0].Id != "1" || srv.alerts[1].Id != "2" {
+		t.Errorf("got %d alerts, want 1 then 2", len(srv.alerts))
+	}
+}
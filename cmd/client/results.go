@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/lithammer/shortuuid"
+	"github.com/opxyc/wd/proto"
+)
+
+// max number of results queued while a batch could not be sent; oldest
+// are dropped first
+const maxPendingResults = 10000
+
+// results collects the results of task runs and sends them to the server
+// in batches. It's nil if results are not to be reported.
+var results *resultBatcher
+
+type resultBatcher struct {
+	mu      sync.Mutex
+	pending []*proto.Result // results not in batch yet
+	dropped int             // results dropped since the last successful send
+	// batch being sent. It's resent with the same ID till the server
+	// acknowledges it, so that the server can skip it if it was received
+	// but the client could not confirm that. Used only by flush.
+	batch *proto.Results
+}
+
+// add queues the result of a run of task t that started at start
+func (b *resultBatcher) add(t *task, start time.Time, err error, metrics []*proto.Metric) {
+	if b == nil {
+		return
+	}
+	r := &proto.Result{
+		Task:     t.Name,
+		Time:     start.UnixNano() / int64(time.Millisecond),
+		Duration: int64(time.Since(start) / time.Millisecond),
+		ExitCode: exitCode(err),
+		Severity: severity(err),
+		Metrics:  metrics,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) >= maxPendingResults {
+		b.pending = b.pending[1:]
+		b.dropped++
+	}
+	b.pending = append(b.pending, r)
+}
+
+// run sends the queued results every interval until ctx is done
+func (b *resultBatcher) run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		b.flush()
+	}
+}
+
+// flush sends the batch that could not be sent earlier, if any, or else a
+// new batch of the queued results. Results queued meanwhile wait for the
+// next flush.
+func (b *resultBatcher) flush() {
+	if b.batch == nil {
+		b.mu.Lock()
+		if len(b.pending) > 0 {
+			b.batch = &proto.Results{Id: shortuuid.New(), Hostname: hostname, Results: b.pending}
+			b.pending = nil
+		}
+		b.mu.Unlock()
+	}
+	if b.batch == nil {
+		return
+	}
+
+	if err := gc.sendResults(b.batch); err != nil {
+		sl.Printf("could not send %d task result(s) to server: %v", len(b.batch.Results), err)
+		return
+	}
+	b.batch = nil
+
+	b.mu.Lock()
+	if b.dropped > 0 {
+		sl.Printf("dropped %d task result(s) that could not be sent in time", b.dropped)
+		b.dropped = 0
+	}
+	b.mu.Unlock()
+}
+
+// exitCode returns the exit code of the command that returned err,
+// or -1 if it timed out or could not be started
+func exitCode(err error) int32 {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return int32(exitErr.ExitCode())
+	}
+	return -1
+}
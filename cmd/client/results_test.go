@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultsResentWithSameID(t *testing.T) {
+	srv := useFakeServer(t)
+	b := &resultBatcher{}
+	b.add(&task{Name: "a"}, time.Now(), nil, nil)
+	b.add(&task{Name: "b"}, time.Now(), nil, nil)
+
+	srv.setDown(true)
+	b.flush()
+	// added while the first batch is not acknowledged
+	b.add(&task{Name: "c"}, time.Now(), nil, nil)
+	srv.setDown(false)
+	b.flush()
+	b.flush()
+	b.flush()
+
+	if len(srv.results) != 3 {
+		t.Fatalf("got %d sends, want 3", len(srv.results))
+	}
+	first, retry, next := srv.results[0], srv.results[1], srv.results[2]
+	if retry.Id != first.Id {
+		t.Errorf("retry has ID %q, want %q of the first attempt", retry.Id, first.Id)
+	}
+	if len(retry.Results) != 2 {
+		t.Errorf("retry has %d results, want 2", len(retry.Results))
+	}
+	if next.Id == first.Id {
+		t.Errorf("next batch reused ID %q", next.Id)
+	}
+	if len(next.Results) != 1 || next.Results[0].Task != "c" {
+		t.Errorf("next batch has %v, want result of c", next.Results)
+	}
+}
+
+func TestResultsDroppedWhileBatchIsPending(t *testing.T) {
+	srv := useFakeServer(t)
+	srv.setDown(true)
+	b := &resultBatcher{}
+	b.add(&task{Name: "first"}, time.Now(), nil, nil)
+	b.flush()
+
+	for i := 0; i < maxPendingResults+5; i++ {
+		b.add(&task{Name: "later"}, time.Now(), nil, nil)
+	}
+	if len(b.pending) != maxPendingResults || b.dropped != 5 {
+		t.Fatalf("got %d pending, %d dropped; want %d, 5", len(b.pending), b.dropped, maxPendingResults)
+	}
+	if b.batch == nil || len(b.batch.Results) != 1 {
+		t.Fatalf("batch being sent changed: %v", b.batch)
+	}
+
+	srv.setDown(false)
+	b.flush()
+	b.flush()
+	if b.dropped != 0 || len(b.pending) != 0 || b.batch != nil {
+		t.Errorf("got %d pending, %d dropped, batch %v after sending all", len(b.pending), b.dropped, b.batch)
+	}
+}
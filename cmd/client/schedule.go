@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// parseSchedule parses the cron expression in t.Schedule, if any
+func (t *task) parseSchedule() error {
+	if t.Schedule == "" {
+		if t.Interval <= 0 {
+			return fmt.Errorf("task %q: either repeatInterval or schedule is required", t.Name)
+		}
+		return nil
+	}
+	s, err := cron.ParseStandard(t.Schedule)
+	if err != nil {
+		return fmt.Errorf("task %q: invalid schedule %q: %v", t.Name, t.Schedule, err)
+	}
+	t.sched = s
+	return nil
+}
+
+// next returns the duration to wait, from now, before the next run of t.
+// A random delay of up to t.Jitter seconds is added to it.
+func (t *task) next(now time.Time) time.Duration {
+	var d time.Duration
+	if t.sched != nil {
+		d = t.sched.Next(now).Sub(now)
+	} else {
+		d = time.Second * time.Duration(t.Interval)
+	}
+	return d + jitter(t.Jitter)
+}
+
+// jitter returns a random duration between 0 and n seconds
+func jitter(n int64) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(time.Second) * n))
+}
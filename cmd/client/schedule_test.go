@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		name string
+		t    task
+		want time.Duration // -1 if parseSchedule should fail
+	}{
+		{name: "interval", t: task{Interval: 90}, want: 90 * time.Second},
+		{name: "cron", t: task{Schedule: "*/15 * * * *"}, want: 7*time.Minute + 30*time.Second},
+		{name: "daily cron", t: task{Schedule: "0 2 * * *"}, want: 15*time.Hour + 52*time.Minute + 30*time.Second},
+		{name: "cron descriptor", t: task{Schedule: "@hourly"}, want: 52*time.Minute + 30*time.Second},
+		{name: "cron over interval", t: task{Schedule: "*/15 * * * *", Interval: 90}, want: 7*time.Minute + 30*time.Second},
+		{name: "neither", t: task{}, want: -1},
+		{name: "negative interval", t: task{Interval: -5}, want: -1},
+		{name: "bad cron", t: task{Schedule: "every minute", Interval: 90}, want: -1},
+		{name: "cron with seconds", t: task{Schedule: "0 */15 * * * *"}, want: -1},
+	}
+	for _, tt := range tests {
+		tt.t.Name = tt.name
+		err := tt.t.parseSchedule()
+		if tt.want < 0 {
+			if err == nil {
+				t.Errorf("%s: parseSchedule succeeded, want error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parseSchedule: %v", tt.name, err)
+			continue
+		}
+		if got := tt.t.next(now); got != tt.want {
+			t.Errorf("%s: next run in %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for _, n := range []int64{0, -1} {
+		if d := jitter(n); d != 0 {
+			t.Errorf("jitter(%d) = %v, want 0", n, d)
+		}
+	}
+
+	tk := task{Name: "t", Interval: 60, Jitter: 2}
+	if err := tk.parseSchedule(); err != nil {
+		t.Fatal(err)
+	}
+	min, max := time.Minute, time.Minute+2*time.Second
+	varied := false
+	for i := 0; i < 1000; i++ {
+		d := tk.next(time.Now())
+		if d < min || d >= max {
+			t.Fatalf("next run in %v, want in [%v, %v)", d, min, max)
+		}
+		varied = varied || d != min
+	}
+	if !varied {
+		t.Error("jitter was never added")
+	}
+}
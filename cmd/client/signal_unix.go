@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// signals that turn maintenance mode on and off
+var maintenanceOn, maintenanceOff os.Signal = syscall.SIGUSR1, syscall.SIGUSR2
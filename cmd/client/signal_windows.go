@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// signals that turn maintenance mode on and off; there are no user
+// defined signals on windows, so only the maintenance file can be used
+var maintenanceOn, maintenanceOff os.Signal
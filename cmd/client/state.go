@@ -0,0 +1,50 @@
+package main
+
+import "time"
+
+// taskState keeps track of consecutive results of a task so that
+// alerts are sent only once a failure is confirmed and repeated
+// at the cadence mentioned in the task.
+type taskState struct {
+	t         *task
+	failures  int       // consecutive failures
+	successes int       // consecutive successes
+	failedID  string    // ID of the first alert sent since the task started failing
+	lastAlert time.Time // time at which last alert was sent
+}
+
+// failed records a failed run and reports whether an alert should be sent for it
+func (s *taskState) failed(now time.Time) bool {
+	s.failures++
+	s.successes = 0
+	if s.failures < s.t.FailuresBeforeAlert {
+		// not confirmed yet
+		return false
+	}
+	if s.failedID == "" {
+		return true
+	}
+	// already alerted; repeat only if realertInterval has passed
+	return now.Sub(s.lastAlert) >= time.Second*time.Duration(s.t.RealertInterval)
+}
+
+// alerted records that alert with given id was sent
+func (s *taskState) alerted(id string, now time.Time) {
+	if s.failedID == "" {
+		s.failedID = id
+	}
+	s.lastAlert = now
+}
+
+// passed records a successful run and returns the ID of the alert to be
+// resolved, if any
+func (s *taskState) passed() string {
+	s.successes++
+	s.failures = 0
+	if s.failedID == "" || s.successes < s.t.SuccessesBeforeRecovery {
+		return ""
+	}
+	id := s.failedID
+	s.failedID = ""
+	return id
+}
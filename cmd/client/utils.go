@@ -1,32 +1,72 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+
+	"github.com/robfig/cron/v3"
 )
 
 type cfg struct {
 	Hostname string `json:"hostname"`
-	Tasks    []task
+	Timeout  int64  `json:"timeout"` // default timeout for tasks and actions
+	Jitter   int64  `json:"jitter"`  // default jitter for tasks
+	// labels added to alerts of all tasks
+	Labels map[string]string `json:"labels"`
+	Tasks  []task
 }
 
 type task struct {
 	Name     string   `json:"name"`
 	Interval int64    `json:"repeatInterval"`
-	Cmd      string   `json:"cmd"`
+	Schedule string   `json:"schedule"` // cron expression; takes precedence over Interval
 	Msg      string   `json:"msg"`
 	Actions  []action `json:"actionsToBeTaken"`
+	// sent along with alerts; used by the server to match alerts, eg. for silences
+	Labels map[string]string `json:"labels"`
+	// number of consecutive failures after which an alert is sent
+	FailuresBeforeAlert int `json:"failuresBeforeAlert"`
+	// number of consecutive successes after which a resolved alert is sent
+	SuccessesBeforeRecovery int `json:"successesBeforeRecovery"`
+	// seconds to wait before alerting again for a task that keeps failing.
+	// 0 means alert on every failed run.
+	RealertInterval int64 `json:"realertInterval"`
+	// run the task once as soon as the client starts instead of waiting for the schedule
+	RunOnStart bool `json:"runOnStart"`
+	// max random delay in seconds added to each run, to spread runs across hosts
+	Jitter int64 `json:"jitter"`
+	command
+
+	sched cron.Schedule // parsed Schedule
 }
 
 type action struct {
 	Name     string `json:"name"`
-	Cmd      string `json:"cmd"`
 	Continue bool   `json:"continueOnFailure"`
+	command
 }
 
+// command holds what is to be executed for a task or an action
+type command struct {
+	Cmd     string            `json:"cmd"`
+	Args    []string          `json:"args"`
+	Shell   bool              `json:"shell"` // run Cmd via /bin/sh -c
+	WorkDir string            `json:"workDir"`
+	Env     map[string]string `json:"env"`
+	// whether to pass client's environment to the cmd. defaults to true.
+	InheritEnv *bool `json:"inheritEnv"`
+	Timeout    int64 `json:"timeout"`
+}
+
+// task names starting with it are reserved for alerts raised by the
+// server itself, eg. when a host stops sending heartbeats
+const reservedTaskPrefix = "wd:"
+
 // reads configuration file
 func readFromCfg(path string) *cfg {
 	f, err := os.Open("config.json")
@@ -40,9 +80,91 @@ func readFromCfg(path string) *cfg {
 	if err != nil {
 		log.Println("could not decode config file:", err)
 	}
+
+	// fill in timeouts that are not mentioned:
+	// action falls back to it's task, task falls back to the global one
+	for i := range cfg.Tasks {
+		t := &cfg.Tasks[i]
+		if strings.HasPrefix(t.Name, reservedTaskPrefix) {
+			sl.Printf("invalid config: task %q: names starting with %q are used by the server\n", t.Name, reservedTaskPrefix)
+			os.Exit(1)
+		}
+		if err := t.parseSchedule(); err != nil {
+			sl.Println("invalid config:", err)
+			os.Exit(1)
+		}
+		if t.Jitter == 0 {
+			t.Jitter = cfg.Jitter
+		}
+		// task labels take precedence over global ones
+		for k, v := range cfg.Labels {
+			if t.Labels == nil {
+				t.Labels = make(map[string]string)
+			}
+			if _, ok := t.Labels[k]; !ok {
+				t.Labels[k] = v
+			}
+		}
+		if t.Timeout == 0 {
+			t.Timeout = cfg.Timeout
+		}
+		for j := range t.Actions {
+			if t.Actions[j].Timeout == 0 {
+				t.Actions[j].Timeout = t.Timeout
+			}
+		}
+	}
 	return &cfg
 }
 
+// inMaintenance reports whether the client is in maintenance mode,
+// i.e., the maintenance file exists
+func inMaintenance() bool {
+	_, err := os.Stat(*mFile)
+	return err == nil
+}
+
+// setMaintenance turns maintenance mode on or off by creating or removing
+// the maintenance file, so that it's kept across restarts
+func setMaintenance(on bool) error {
+	if on {
+		f, err := os.OpenFile(*mFile, os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	if err := os.Remove(*mFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// watchMaintenance turns maintenance mode on and off on receiving
+// maintenanceOn and maintenanceOff until ctx is done
+func watchMaintenance(ctx context.Context) {
+	if maintenanceOn == nil {
+		// not supported on this platform
+		return
+	}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, maintenanceOn, maintenanceOff)
+	defer signal.Stop(sigChan)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigChan:
+			on := sig == maintenanceOn
+			if err := setMaintenance(on); err != nil {
+				sl.Printf("could not set maintenance mode on %v: %v\n", sig, err)
+				continue
+			}
+			sl.Printf("maintenance mode set to %v on %v\n", on, sig)
+		}
+	}
+}
+
 // mlog will log given tName, err, op and info to the logger l and
 // return what ever is logged
 func mlog(l *log.Logger, tName string, err error, op string, info string) string {
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// apiError is an error with the http status code to be sent for it
+type apiError struct {
+	code int
+	msg  string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+// errMethod returns the error to be sent for a request with a method that is not supported
+func errMethod(method string) error {
+	return &apiError{http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", method)}
+}
+
+// apiHandler wraps f, writing the value it returns as JSON.
+// If f returns an error, it is sent with the status code in it, if it is
+// an *apiError, or 400.
+func apiHandler(f func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		v, err := f(r)
+		if err != nil {
+			code := http.StatusBadRequest
+			if e, ok := err.(*apiError); ok {
+				code = e.code
+			}
+			http.Error(rw, err.Error(), code)
+			l.Printf("error handling %v: %v", r.RequestURI, err)
+			return
+		}
+		if c, ok := v.(*setCookie); ok {
+			http.SetCookie(rw, c.c)
+			v = c.v
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(rw).Encode(v); err != nil {
+			l.Printf("error writing response for %v: %v", r.RequestURI, err)
+		}
+	}
+}
+
+// listAlerts handles GET /alerts. Supported query params:
+//
+//	host, task, status, severity - match the respective fields
+//	from, to                     - range of time (RFC 3339) at which alerts were received
+//	offset, limit                - pagination; alerts are returned newest first
+func listAlerts(r *http.Request) (interface{}, error) {
+	if r.Method != http.MethodGet {
+		return nil, errMethod(r.Method)
+	}
+
+	q := r.URL.Query()
+	f := &alertFilter{
+		Host:     q.Get("host"),
+		Task:     q.Get("task"),
+		Severity: q.Get("severity"),
+		Allow:    userFrom(r).canSee,
+	}
+	if v := q.Get("status"); v != "" {
+		s, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q", v)
+		}
+		st := int32(s)
+		f.Status = &st
+	}
+	var err error
+	if f.From, err = parseTime(q.Get("from")); err != nil {
+		return nil, err
+	}
+	if f.To, err = parseTime(q.Get("to")); err != nil {
+		return nil, err
+	}
+
+	offset, err := parseInt(q.Get("offset"), 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := parseInt(q.Get("limit"), defaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	alerts, total, err := db.list(f, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	if alerts == nil {
+		alerts = []*storedAlert{}
+	}
+	return struct {
+		Total  int            `json:"total"`
+		Alerts []*storedAlert `json:"alerts"`
+	}{total, alerts}, nil
+}
+
+// parseTime parses an RFC 3339 time. Empty string gives zero time.
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q, expected RFC 3339", v)
+	}
+	return t, nil
+}
+
+// parseInt parses a non negative integer, returning def for empty string
+func parseInt(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q", v)
+	}
+	return n, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// how often the token file is checked for changes
+const tokenReloadInterval = 10 * time.Second
+
+// tokenFile is the file with the tokens clients authenticate with
+type tokenFile struct {
+	Tokens []*token `json:"tokens"`
+}
+
+// token lets clients send msgs for the hosts matching it. It's also
+// how users of the HTTP API authenticate (see user).
+type token struct {
+	Name   string `json:"name"`             // who it's issued to
+	Token  string `json:"token,omitempty"`  // the token itself, or
+	SHA256 string `json:"sha256,omitempty"` // its SHA-256, hex encoded
+	// hosts the token can be used for; globs, eg. "db-*" for a group of hosts
+	Hosts   []string `json:"hosts"`
+	Revoked bool     `json:"revoked,omitempty"`
+
+	sum []byte // SHA-256 of the token
+}
+
+var (
+	tokensMu   sync.RWMutex
+	tokens     []*token
+	tokensPath string    // path of token file; clients are not authenticated if empty
+	tokensMod  time.Time // modification time of token file when it was read
+
+	audit *log.Logger // logs rejected requests
+)
+
+// readTokens reads and validates the token file at p
+func readTokens(p string) ([]*token, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tf := &tokenFile{}
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(tf); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %v", p, err)
+	}
+
+	names := map[string]bool{}
+	for i, t := range tf.Tokens {
+		if err := t.init(); err != nil {
+			return nil, fmt.Errorf("token %d: %v", i+1, err)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("token %q: duplicate name", t.Name)
+		}
+		names[t.Name] = true
+	}
+	return tf.Tokens, nil
+}
+
+// init validates t and computes its sum
+func (t *token) init() error {
+	if t.Name == "" {
+		return errors.New("no name")
+	}
+	switch {
+	case t.Token != "" && t.SHA256 == "":
+		sum := sha256.Sum256([]byte(t.Token))
+		t.sum = sum[:]
+	case t.Token == "" && t.SHA256 != "":
+		var err error
+		t.sum, err = hex.DecodeString(t.SHA256)
+		if err != nil || len(t.sum) != sha256.Size {
+			return fmt.Errorf("%q: invalid sha256", t.Name)
+		}
+	default:
+		return fmt.Errorf("%q: either token or sha256 should be given", t.Name)
+	}
+	for _, h := range t.Hosts {
+		if _, err := path.Match(h, ""); err != nil {
+			return fmt.Errorf("%q: invalid pattern %q", t.Name, h)
+		}
+	}
+	return nil
+}
+
+// matches reports whether s is the token t
+func (t *token) matches(s string) bool {
+	sum := sha256.Sum256([]byte(s))
+	return subtle.ConstantTimeCompare(sum[:], t.sum) == 1
+}
+
+// loadTokens reads the token file at p and starts using the tokens in it
+func loadTokens(p string) error {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	ts, err := readTokens(p)
+	if err != nil {
+		return err
+	}
+
+	tokensMu.Lock()
+	tokens, tokensPath, tokensMod = ts, p, fi.ModTime()
+	tokensMu.Unlock()
+	if len(ts) == 0 {
+		l.Printf("no tokens in %s; all clients will be rejected\n", p)
+		audit.Printf("no tokens in %s; all clients will be rejected\n", p)
+	}
+	return nil
+}
+
+// reloadTokens reads the token file again. On error, the tokens read
+// earlier are kept.
+func reloadTokens() {
+	if err := loadTokens(tokensPath); err != nil {
+		l.Printf("could not reload tokens: %v\n", err)
+		audit.Printf("could not reload tokens from %s: %v\n", tokensPath, err)
+		return
+	}
+	tokensMu.RLock()
+	n := len(tokens)
+	tokensMu.RUnlock()
+	l.Printf("reloaded %d token(s) from %s\n", n, tokensPath)
+	audit.Printf("reloaded %d token(s) from %s\n", n, tokensPath)
+}
+
+// watchTokens reloads the token file when it changes, until ctx is done
+func watchTokens(ctx context.Context) {
+	t := time.NewTicker(tokenReloadInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			fi, err := os.Stat(tokensPath)
+			if err != nil {
+				l.Printf("could not check token file: %v\n", err)
+				continue
+			}
+			tokensMu.RLock()
+			changed := !fi.ModTime().Equal(tokensMod)
+			tokensMu.RUnlock()
+			if changed {
+				reloadTokens()
+			}
+		}
+	}
+}
+
+// lookupToken returns the token matching s, or nil
+func lookupToken(s string) *token {
+	tokensMu.RLock()
+	defer tokensMu.RUnlock()
+	for _, t := range tokens {
+		if t.matches(s) {
+			return t
+		}
+	}
+	return nil
+}
+
+// allows reports whether t can be used to send msgs as host
+func (t *token) allows(host string) bool {
+	for _, p := range t.Hosts {
+		if ok, _ := path.Match(p, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// authInterceptor checks that requests carry a valid token that is
+// allowed to be used for the host they are sent as. If a token file is
+// given, but has no tokens, all requests are rejected.
+func authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	tokensMu.RLock()
+	enabled := tokensPath != ""
+	tokensMu.RUnlock()
+	if !enabled {
+		return handler(ctx, req)
+	}
+
+	method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+	host := requestHost(req)
+	if t, err := authenticate(ctx, host); err != nil {
+		if t != nil {
+			method += " with token " + t.Name
+		}
+		reject(ctx, method, host, err)
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authenticate finds the token in ctx and checks that it can be used for host
+func authenticate(ctx context.Context, host string) (*token, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var s string
+	if v := md.Get("authorization"); len(v) > 0 {
+		s = strings.TrimPrefix(v[0], "Bearer ")
+	}
+	if s == "" {
+		return nil, status.Error(codes.Unauthenticated, "no token")
+	}
+	t := lookupToken(s)
+	switch {
+	case t == nil:
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	case t.Revoked:
+		return t, status.Error(codes.Unauthenticated, "token revoked")
+	case host == "" || !t.allows(host):
+		return t, status.Errorf(codes.PermissionDenied, "token cannot be used for host %q", host)
+	}
+	return t, nil
+}
+
+// requestHost returns the host a request is sent as
+func requestHost(req interface{}) string {
+	switch r := req.(type) {
+	case *proto.Alert:
+		return r.GetFrom().GetHostname()
+	case *proto.Heartbeat:
+		return r.GetHostname()
+	case *proto.Results:
+		return r.GetHostname()
+	}
+	return ""
+}
+
+// reject logs a rejected request to the audit log
+func reject(ctx context.Context, method, host string, err error) {
+	msg := status.Convert(err).Message()
+	l.Printf("rejected %s as %q from %s: %s\n", method, host, peerAddr(ctx), msg)
+	audit.Printf("rejected %s as %q from %s: %s\n", method, host, peerAddr(ctx), msg)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opxyc/wd/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// useTokens loads a token file with content s for the duration of the test
+func useTokens(t *testing.T, s string) {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(p, []byte(s), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTokens(p); err != nil {
+		t.Fatalf("loadTokens: %v", err)
+	}
+	t.Cleanup(func() {
+		tokensMu.Lock()
+		tokens, tokensPath = nil, ""
+		tokensMu.Unlock()
+	})
+}
+
+// callAs calls authInterceptor with an alert from host, carrying tok if it's not empty
+func callAs(host, tok string) error {
+	ctx := context.Background()
+	if tok != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tok))
+	}
+	req := &proto.Alert{From: &proto.From{Hostname: host}}
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.AlertService/SendAlert"}
+	_, err := authInterceptor(ctx, req, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	return err
+}
+
+func TestAuthDisabledWithoutTokenFile(t *testing.T) {
+	if err := callAs("db-1", ""); err != nil {
+		t.Fatalf("got %v, want request to pass", err)
+	}
+}
+
+func TestAuthFailsClosedOnEmptyTokenFile(t *testing.T) {
+	for _, s := range []string{`{}`, `{"tokens":null}`, `{"tokens":[]}`} {
+		t.Run(s, func(t *testing.T) {
+			useTokens(t, s)
+			for _, tok := range []string{"", "anything"} {
+				if code := status.Code(callAs("db-1", tok)); code != codes.Unauthenticated {
+					t.Errorf("token %q: got %v, want %v", tok, code, codes.Unauthenticated)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthTokens(t *testing.T) {
+	useTokens(t, `{"tokens":[
+		{"name":"db","token":"s3cret","hosts":["db-*"]},
+		{"name":"old","token":"0ld","hosts":["*"],"revoked":true}
+	]}`)
+
+	tests := []struct {
+		host, tok string
+		want      codes.Code
+	}{
+		{"db-1", "s3cret", codes.OK},
+		{"web-1", "s3cret", codes.PermissionDenied},
+		{"db-1", "wrong", codes.Unauthenticated},
+		{"db-1", "", codes.Unauthenticated},
+		{"db-1", "0ld", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		if got := status.Code(callAs(tt.host, tt.tok)); got != tt.want {
+			t.Errorf("%s with %q: got %v, want %v", tt.host, tt.tok, got, tt.want)
+		}
+	}
+}
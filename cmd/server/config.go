@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// config is the server config file
+type config struct {
+	// where notifications are sent to
+	Receivers []receiverCfg `json:"receivers"`
+	// which alerts go to which receivers
+	Routes []*route `json:"routes"`
+	// who else to notify about alerts that are not acknowledged in time
+	Escalations []*escalation `json:"escalations"`
+	// how to group alerts into a single notification
+	Group *groupCfg `json:"group"`
+	// when hosts that stopped sending heartbeats are alerted
+	Heartbeat *heartbeatCfg `json:"heartbeat"`
+	// who can use the HTTP API and websocket; open to everyone if empty
+	Users []*user `json:"users"`
+	// origins from which websocket connections are accepted; if empty,
+	// all when there are no users and only the same origin otherwise
+	AllowedOrigins []string `json:"allowedOrigins"`
+}
+
+// readConfig reads the config file at path. Empty path gives an empty config.
+func readConfig(path string) (*config, error) {
+	cfg := &config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %v", path, err)
+	}
+	return cfg, nil
+}
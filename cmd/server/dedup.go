@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"sync"
+)
+
+// recentIDs remembers the last n alert IDs received so that alerts
+// replayed by clients (after a failed send) are not handled twice
+type recentIDs struct {
+	mu   sync.Mutex
+	ids  map[string]struct{}
+	ring []string // insertion order; oldest is evicted first
+	next int
+}
+
+func newRecentIDs(n int) *recentIDs {
+	return &recentIDs{
+		ids:  make(map[string]struct{}, n),
+		ring: make([]string, n),
+	}
+}
+
+// add adds id to r and reports whether it was already present
+func (r *recentIDs) add(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.ids[id]; ok {
+		return true
+	}
+	if old := r.ring[r.next]; old != "" {
+		delete(r.ids, old)
+	}
+	r.ring[r.next] = id
+	r.next = (r.next + 1) % len(r.ring)
+	r.ids[id] = struct{}{}
+	return false
+}
+
+// fingerprint identifies the problem an alert is about by the host and
+// task that raised it and its labels
+func fingerprint(host, task string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha1.New()
+	h.Write([]byte(host + "\x00" + task))
+	for _, k := range keys {
+		h.Write([]byte("\x00" + k + "=" + labels[k]))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
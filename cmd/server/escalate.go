@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// how often open alerts are checked for escalation
+const escalationCheckInterval = 30 * time.Second
+
+// escalation is a policy to notify more receivers about alerts matching it
+// that stay open without being acknowledged
+type escalation struct {
+	Name   string            `json:"name"`
+	Match  matcher           `json:"match"`
+	Levels []escalationLevel `json:"levels"`
+}
+
+type escalationLevel struct {
+	// time since the alert was received after which this level is notified
+	After     duration `json:"after"`
+	Receivers []string `json:"receivers"`
+}
+
+// duration is a time.Duration read from a string like "1h30m" in JSON
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// escalations from config
+var escalations []*escalation
+
+// validateEscalations checks the policies in es
+func validateEscalations(es []*escalation) error {
+	for _, e := range es {
+		if e.Name == "" {
+			return errors.New("escalation without name")
+		}
+		if err := e.Match.validate(); err != nil {
+			return fmt.Errorf("escalation %q: %v", e.Name, err)
+		}
+		if len(e.Levels) == 0 {
+			return fmt.Errorf("escalation %q: no levels", e.Name)
+		}
+		var prev duration
+		for i, lvl := range e.Levels {
+			if lvl.After <= prev {
+				return fmt.Errorf("escalation %q: after of level %d should be greater than that of the previous level", e.Name, i+1)
+			}
+			prev = lvl.After
+			for _, name := range lvl.Receivers {
+				if _, ok := receivers[name]; !ok {
+					return fmt.Errorf("escalation %q: unknown receiver %q", e.Name, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// escalationFor returns the first policy that matches a, or nil
+func escalationFor(a *msgFormat) *escalation {
+	for _, e := range escalations {
+		if e.Match.match(a) {
+			return e
+		}
+	}
+	return nil
+}
+
+// escalate checks open alerts for escalation every escalationCheckInterval
+// until ctx is done. The level up to which an alert has been escalated is
+// kept in the store, so escalation picks up where it left off after a restart.
+func escalate(ctx context.Context) {
+	if len(escalations) == 0 {
+		return
+	}
+
+	t := time.NewTicker(escalationCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			checkEscalations(now)
+		}
+	}
+}
+
+// checkEscalations notifies the levels that are due for open alerts
+func checkEscalations(now time.Time) {
+	open, err := db.open()
+	if err != nil {
+		l.Printf("could not look up open alerts for escalation: %v\n", err)
+		return
+	}
+
+	for _, a := range open {
+		// acknowledged means someone is on it
+		if a.State != stateOpen || a.SilencedBy != "" {
+			continue
+		}
+		e := escalationFor(&a.msgFormat)
+		if e == nil {
+			continue
+		}
+
+		// notify all levels that are due, in case some were missed while the server was down
+		for lvl := a.Escalation; lvl < len(e.Levels) && now.Sub(a.Received) >= time.Duration(e.Levels[lvl].After); lvl++ {
+			level := lvl + 1
+			updated, err := db.update(a.ID, func(a *storedAlert) error {
+				if a.State != stateOpen || a.Escalation >= level {
+					// acked or escalated since we looked
+					return errInvalidTransition
+				}
+				a.Escalation = level
+				return nil
+			})
+			if err != nil {
+				if err != errInvalidTransition {
+					l.Printf("could not escalate alert %s: %v\n", a.ID, err)
+				}
+				break
+			}
+
+			l.Printf("%-23s escalated to level %d of %s: %v\n", a.ID, level, e.Name, e.Levels[lvl].Receivers)
+			m := updated.msgFormat
+			for _, name := range e.Levels[lvl].Receivers {
+				receivers[name].sendAsync(&m)
+			}
+			u := updated.msgFormat
+			u.Update = true
+			pushmsg(&u)
+		}
+	}
+}
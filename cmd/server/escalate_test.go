@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// notified returns the alerts sent to n since it was last called, waiting
+// for want of them and making sure no more follow
+func notified(t *testing.T, n *fakeNotifier, want int) []*msgFormat {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for i := 0; i < want; i++ {
+		select {
+		case <-n.done:
+		case <-timeout:
+			t.Fatalf("got %d notifications, want %d", i, want)
+		}
+	}
+	select {
+	case <-n.done:
+		t.Fatalf("got more than %d notifications", want)
+	case <-time.After(50 * time.Millisecond):
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sent := n.sent
+	n.sent = nil
+	return sent
+}
+
+func TestCheckEscalations(t *testing.T) {
+	useStore(t)
+	useHub(t)
+	n := &fakeNotifier{done: make(chan struct{}, 10)}
+	useReceiver(t, n)
+	escalations = []*escalation{{
+		Name: "oncall",
+		Levels: []escalationLevel{
+			{After: duration(time.Minute), Receivers: []string{"test"}},
+			{After: duration(5 * time.Minute), Receivers: []string{"test"}},
+			{After: duration(time.Hour), Receivers: []string{"test"}},
+		},
+	}}
+	t.Cleanup(func() { escalations = nil })
+
+	now := time.Now()
+	for _, id := range []string{"open", "acked"} {
+		a := newStored(id, "db-1", id)
+		a.Received = now.Add(-10 * time.Minute)
+		if _, _, err := db.add(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.update("acked", func(a *storedAlert) error {
+		return ack(a, "test", "", now)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// both levels that became due while nobody checked are notified
+	checkEscalations(now)
+	sent := notified(t, n, 2)
+	for _, m := range sent {
+		if m.ID != "open" {
+			t.Errorf("acknowledged alert %s was escalated", m.ID)
+		}
+	}
+	if sent[0].Escalation+sent[1].Escalation != 3 {
+		t.Errorf("got levels %d and %d, want 1 and 2", sent[0].Escalation, sent[1].Escalation)
+	}
+
+	// the level is kept across restarts
+	path := db.db.Path()
+	db.Close()
+	var err error
+	if db, err = openStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if a, err := db.get("open"); err != nil || a.Escalation != 2 {
+		t.Fatalf("after reopening: got level %d, %v; want 2", a.Escalation, err)
+	}
+	checkEscalations(now)
+	notified(t, n, 0)
+
+	checkEscalations(now.Add(time.Hour))
+	if sent := notified(t, n, 1); sent[0].ID != "open" || sent[0].Escalation != 3 {
+		t.Errorf("got %s at level %d, want open at level 3", sent[0].ID, sent[0].Escalation)
+	}
+
+	// acknowledging stops it
+	if _, err := db.update("open", func(a *storedAlert) error {
+		return ack(a, "test", "", now)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	escalations[0].Levels = append(escalations[0].Levels, escalationLevel{After: duration(2 * time.Hour), Receivers: []string{"test"}})
+	checkEscalations(now.Add(3 * time.Hour))
+	notified(t, n, 0)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// comments are sent on idle SSE streams at this interval so that
+	// proxies do not close them
+	sseKeepAlive = 30 * time.Second
+	// default and max time a long-poll request waits for msgs
+	defaultPollWait = 30 * time.Second
+	maxPollWait     = 2 * time.Minute
+)
+
+// eventID returns the ID of the msg with sequence number seq. It has the
+// time at which the server started, as sequence numbers start over on restart.
+func eventID(seq uint64) string {
+	return fmt.Sprintf("%d-%d", started.Unix(), seq)
+}
+
+// parseEventID returns the sequence number in id. ok is false if id is
+// invalid or from before the server was restarted.
+func parseEventID(id string) (seq uint64, ok bool) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 || parts[0] != strconv.FormatInt(started.Unix(), 10) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	return seq, err == nil
+}
+
+// eventsHandler streams msgs as Server-Sent Events; the same msgs that are
+// sent to websocket connections, with the same replay query params.
+// A client that reconnects with Last-Event-ID gets the msgs it missed, if
+// they're still kept, instead of the replay it asked for. Otherwise, it's
+// sent a "reset" event and the replay, after which it should reload
+// whatever it shows.
+func eventsHandler(ws *WS, rw http.ResponseWriter, r *http.Request) error {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming not supported")
+	}
+
+	filter, err := parseMatcher(r.URL.Query())
+	if err != nil {
+		return &apiError{http.StatusBadRequest, err.Error()}
+	}
+	s, _, err := ws.register(r.RemoteAddr, r.URL.Path, userFrom(r), filter)
+	if err != nil {
+		return err
+	}
+	defer ws.unregister(s)
+
+	// msgs missed since the last connection; those broadcast after
+	// registering are also sent to s.send, so skip them there
+	var missed []*event
+	var last uint64
+	resumed, reset := false, false
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		seq, ok := parseEventID(id)
+		if ok {
+			missed, ok = ws.since(seq, s)
+		}
+		if ok {
+			resumed, last = true, seq
+		}
+		reset = !ok
+	}
+	// EventSource reconnects with the same URL; the alerts asked for
+	// there were sent on the first connection
+	var replay []*storedAlert
+	if !resumed {
+		var replayReset bool
+		replay, replayReset, err = replayAlerts(r.URL.Query(), s.user, filter)
+		if err != nil {
+			return err
+		}
+		reset = reset || replayReset
+	}
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+
+	if reset {
+		fmt.Fprint(rw, "event: reset\ndata: {}\n\n")
+	}
+	for _, a := range replay {
+		m := a.msgFormat
+		m.Replay = true
+		b, err := json.Marshal(m)
+		if err != nil {
+			ws.l.Printf("failed to marshal msg: %v", err)
+			continue
+		}
+		// no id; they're not in the sequence of broadcast msgs
+		fmt.Fprintf(rw, "data: %s\n\n", b)
+	}
+	for _, e := range missed {
+		writeEvent(rw, e)
+		last = e.seq
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-s.send:
+			if !ok {
+				// removed from ws for not keeping up
+				return nil
+			}
+			if e.seq <= last {
+				continue
+			}
+			last = e.seq
+			writeEvent(rw, e)
+		case <-ticker.C:
+			fmt.Fprint(rw, ": ping\n\n")
+		case <-r.Context().Done():
+			return nil
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(rw http.ResponseWriter, e *event) {
+	fmt.Fprintf(rw, "id: %s\ndata: %s\n\n", eventID(e.seq), e.data)
+}
+
+// waitHandler handles long-poll requests:
+//
+//	GET /alerts/wait?since=CURSOR&timeout=30s
+//
+// It returns the msgs broadcast after since (the cursor returned by the
+// previous request), waiting up to timeout for one if there are none.
+// Without since, it waits for the next msg. If msgs after since are no
+// longer kept, reset is set and the client should reload what it shows.
+func waitHandler(r *http.Request) (interface{}, error) {
+	if r.Method != http.MethodGet {
+		return nil, errMethod(r.Method)
+	}
+
+	q := r.URL.Query()
+	wait := defaultPollWait
+	if v := q.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid timeout %q", v)
+		}
+		if d > maxPollWait {
+			d = maxPollWait
+		}
+		wait = d
+	}
+
+	filter, err := parseMatcher(q)
+	if err != nil {
+		return nil, err
+	}
+	// msgs after last are sent to s.send
+	s, last, err := ws.register(r.RemoteAddr, r.URL.Path, userFrom(r), filter)
+	if err != nil {
+		return nil, &apiError{http.StatusServiceUnavailable, err.Error()}
+	}
+	defer ws.unregister(s)
+
+	var resp struct {
+		Cursor string            `json:"cursor"`
+		Reset  bool              `json:"reset,omitempty"`
+		Events []json.RawMessage `json:"events"`
+	}
+	resp.Events = []json.RawMessage{}
+
+	if v := q.Get("since"); v != "" {
+		seq, ok := parseEventID(v)
+		var missed []*event
+		if ok {
+			missed, ok = ws.since(seq, s)
+		}
+		if !ok {
+			resp.Reset, resp.Cursor = true, eventID(last)
+			return resp, nil
+		}
+		last = seq
+		for _, e := range missed {
+			resp.Events = append(resp.Events, e.data)
+			last = e.seq
+		}
+	}
+
+	if len(resp.Events) == 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+	wait:
+		for {
+			select {
+			case e, ok := <-s.send:
+				if !ok {
+					break wait
+				}
+				if e.seq <= last {
+					continue
+				}
+				resp.Events = append(resp.Events, e.data)
+				last = e.seq
+				break wait
+			case <-timer.C:
+				break wait
+			case <-r.Context().Done():
+				return nil, r.Context().Err()
+			}
+		}
+	}
+
+	// take whatever else has arrived meanwhile
+	for drained := false; !drained; {
+		select {
+		case e, ok := <-s.send:
+			if !ok {
+				drained = true
+				break
+			}
+			if e.seq > last {
+				resp.Events = append(resp.Events, e.data)
+				last = e.seq
+			}
+		default:
+			drained = true
+		}
+	}
+
+	resp.Cursor = eventID(last)
+	return resp, nil
+}
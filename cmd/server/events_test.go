@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stream connects to /events with Last-Event-ID lastID, calls during while
+// connected, and returns what was streamed
+func stream(t *testing.T, hub *WS, url, lastID string, during func()) string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, url, nil).WithContext(ctx)
+	if lastID != "" {
+		r.Header.Set("Last-Event-ID", lastID)
+	}
+	rw := httptest.NewRecorder()
+
+	done := make(chan error)
+	go func() { done <- eventsHandler(hub, rw, r) }()
+	// wait for it to subscribe
+	for i := 0; hub.subscribers() == 0; i++ {
+		if i > 100 {
+			t.Fatal("handler did not subscribe")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if during != nil {
+		during()
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return rw.Body.String()
+}
+
+// subscribers returns the number of subscribers of ws
+func (ws *WS) subscribers() int {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return len(ws.cons)
+}
+
+func TestEventsResume(t *testing.T) {
+	useStore(t)
+	hub := useHub(t)
+	if _, _, err := db.add(newStored("r1", "db-1", "disk")); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []string{"one", "two", "three"} {
+		hub.Broadcast([]byte(m), "db-1", nil)
+	}
+
+	// first connection: replay only
+	got := stream(t, hub, "/events?last=5", "", nil)
+	if !strings.Contains(got, `"id":"r1"`) || strings.Contains(got, "id: ") {
+		t.Errorf("first connection got:\n%s\nwant the replayed alert only", got)
+	}
+
+	// reconnection: the missed msgs, without the replay again
+	got = stream(t, hub, "/events?last=5", eventID(1), nil)
+	want := "id: " + eventID(2) + "\ndata: two\n\nid: " + eventID(3) + "\ndata: three\n\n"
+	if got != want {
+		t.Errorf("resumed connection got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEventsResumeFromUnknownID(t *testing.T) {
+	useStore(t)
+	hub := useHub(t)
+	hub.Broadcast([]byte("one"), "db-1", nil)
+
+	for _, id := range []string{eventID(100), "12-1", "junk"} {
+		got := stream(t, hub, "/events", id, func() {
+			hub.Broadcast([]byte("next"), "db-1", nil)
+		})
+		if !strings.HasPrefix(got, "event: reset\n") {
+			t.Errorf("Last-Event-ID %s: got:\n%s\nwant a reset first", id, got)
+		}
+		if !strings.Contains(got, "data: next\n") {
+			t.Errorf("Last-Event-ID %s: got:\n%s\nwant msgs broadcast after connecting", id, got)
+		}
+	}
+}
+
+// poll makes a long-poll request with given query and returns the cursor
+// and msgs it got, calling during, if given, once it's waiting
+func poll(t *testing.T, query string, during func()) (cursor string, msgs []string) {
+	t.Helper()
+	type result struct {
+		resp interface{}
+		err  error
+	}
+	done := make(chan result)
+	go func() {
+		resp, err := waitHandler(httptest.NewRequest(http.MethodGet, "/alerts/wait?"+query, nil))
+		done <- result{resp, err}
+	}()
+	if during != nil {
+		for i := 0; ws.subscribers() == 0; i++ {
+			if i > 100 {
+				t.Fatal("handler did not subscribe")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		during()
+	}
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	b, _ := json.Marshal(res.resp)
+	var resp struct {
+		Cursor string   `json:"cursor"`
+		Events []string `json:"events"`
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Cursor, resp.Events
+}
+
+func TestWaitCursor(t *testing.T) {
+	hub := useHub(t)
+	hub.Broadcast([]byte(`"before"`), "db-1", nil)
+
+	cursor, msgs := poll(t, "timeout=2s", func() {
+		hub.Broadcast([]byte(`"one"`), "db-1", nil)
+	})
+	if cursor != eventID(2) || len(msgs) != 1 || msgs[0] != "one" {
+		t.Fatalf("got %v with cursor %s, want [one] with cursor %s", msgs, cursor, eventID(2))
+	}
+
+	hub.Broadcast([]byte(`"two"`), "db-1", nil)
+	cursor, msgs = poll(t, "timeout=2s&since="+cursor, nil)
+	if cursor != eventID(3) || len(msgs) != 1 || msgs[0] != "two" {
+		t.Errorf("got %v with cursor %s, want [two] with cursor %s", msgs, cursor, eventID(3))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+// groupCfg groups alerts that are to be sent to a receiver within Wait of
+// each other and share the fields in By into a single notification
+type groupCfg struct {
+	// host, task, severity, status or label:<name>
+	By   []string `json:"by"`
+	Wait duration `json:"wait"`
+}
+
+// group is a set of alerts waiting to be sent to a receiver
+type group struct {
+	alerts []*msgFormat
+}
+
+var (
+	grouping *groupCfg // from config; nil if alerts are not to be grouped
+	groupsMu sync.Mutex
+	groups   = map[string]*group{} // receiver name + group key -> group
+)
+
+func (g *groupCfg) validate() error {
+	if g.Wait <= 0 {
+		return errors.New("wait should be greater than 0")
+	}
+	for _, f := range g.By {
+		switch {
+		case f == "host", f == "task", f == "severity", f == "status":
+		case strings.HasPrefix(f, "label:") && len(f) > len("label:"):
+		default:
+			return fmt.Errorf("cannot group by %q", f)
+		}
+	}
+	return nil
+}
+
+// key returns the values of the fields a is grouped by. Alerts are always
+// grouped by status as well, so that a summary never mixes failures with
+// recoveries.
+func (g *groupCfg) key(a *msgFormat) string {
+	k := []string{fmt.Sprint(a.Status)}
+	for _, f := range g.By {
+		switch f {
+		case "host":
+			k = append(k, a.From)
+		case "task":
+			k = append(k, a.TaskName)
+		case "severity":
+			k = append(k, a.Severity)
+		case "status":
+			// already in k
+		default:
+			k = append(k, a.Labels[strings.TrimPrefix(f, "label:")])
+		}
+	}
+	return strings.Join(k, "\x00")
+}
+
+// sendGrouped adds a to its group for receiver r, sending the group once
+// grouping.Wait has passed since the first alert was added to it
+func sendGrouped(r *receiver, a *msgFormat) {
+	k := r.name + "\x00" + grouping.key(a)
+
+	groupsMu.Lock()
+	defer groupsMu.Unlock()
+	if g, ok := groups[k]; ok {
+		g.alerts = append(g.alerts, a)
+		return
+	}
+	groups[k] = &group{alerts: []*msgFormat{a}}
+
+	time.AfterFunc(time.Duration(grouping.Wait), func() {
+		groupsMu.Lock()
+		g := groups[k]
+		delete(groups, k)
+		groupsMu.Unlock()
+
+		if len(g.alerts) == 1 {
+			r.sendAsync(g.alerts[0])
+			return
+		}
+		r.sendAsync(summarize(g.alerts))
+	})
+}
+
+// summarize combines alerts into a single one to be notified
+func summarize(alerts []*msgFormat) *msgFormat {
+	first := alerts[0]
+	s := &msgFormat{
+		Time:     first.Time,
+		ID:       first.ID,
+		From:     first.From,
+		TaskName: first.TaskName,
+		Status:   first.Status,
+		Severity: first.Severity,
+		State:    first.State,
+	}
+
+	var hosts, tasks []string
+	seenHost, seenTask := map[string]bool{}, map[string]bool{}
+	var long strings.Builder
+	for _, a := range alerts {
+		if !seenHost[a.From] {
+			seenHost[a.From] = true
+			hosts = append(hosts, a.From)
+		}
+		if !seenTask[a.TaskName] {
+			seenTask[a.TaskName] = true
+			tasks = append(tasks, a.TaskName)
+		}
+		// highest severity of the lot
+		if proto.Severity_value[a.Severity] > proto.Severity_value[s.Severity] {
+			s.Severity = a.Severity
+		}
+		s.Grouped = append(s.Grouped, a.ID)
+		fmt.Fprintf(&long, "%-23s %-16s %-16s %-8s %s\n", a.ID, a.From, a.TaskName, a.Severity, a.Short)
+	}
+	sort.Strings(hosts)
+	sort.Strings(tasks)
+
+	if len(hosts) > 1 {
+		s.From = fmt.Sprintf("%d hosts", len(hosts))
+	}
+	if len(tasks) > 1 {
+		s.TaskName = fmt.Sprintf("%d tasks", len(tasks))
+	}
+	s.Short = fmt.Sprintf("%d alerts: %s on %s", len(alerts), strings.Join(tasks, ", "), strings.Join(hosts, ", "))
+	s.Long = long.String()
+	return s
+}
@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestGroupKeyHasStatus(t *testing.T) {
+	g := &groupCfg{By: []string{"task"}, Wait: 1}
+	failed := &msgFormat{From: "db-1", TaskName: "disk", Status: 1}
+	resolved := &msgFormat{From: "db-2", TaskName: "disk", Status: 2}
+	if g.key(failed) == g.key(resolved) {
+		t.Errorf("failed and resolved alerts of a task got the same key")
+	}
+	if other := (&msgFormat{From: "db-3", TaskName: "disk", Status: 1}); g.key(failed) != g.key(other) {
+		t.Errorf("failed alerts of a task got different keys")
+	}
+}
@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/opxyc/wd/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-// gRPCServer creates a gRPC server and server
-func gRPCServer(addr string) {
-	srv := grpc.NewServer()
+// gRPCServer creates a gRPC server and server. If tlsCfg is nil, it's
+// served in plaintext.
+func gRPCServer(addr string, tlsCfg *tls.Config) {
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(authInterceptor)}
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	srv := grpc.NewServer(opts...)
 	var pb pbSrv
 	proto.RegisterWatchdogServer(srv, pb)
 	lsnr, err := net.Listen("tcp", addr)
@@ -26,42 +34,146 @@ func gRPCServer(addr string) {
 
 type pbSrv struct{}
 
+// IDs of alerts received recently. Clients resend alerts that they
+// could not confirm as sent, so the same alert can arrive more than once.
+var seen = newRecentIDs(10000)
+
 func (pbSrv) SendAlert(ctx context.Context, msg *proto.Alert) (*proto.Void, error) {
+	if err := checkHostname(ctx, msg.From.GetHostname()); err != nil {
+		reject(ctx, "SendAlert", msg.From.GetHostname(), err)
+		return nil, err
+	}
+	handleAlert(msg)
+	return &proto.Void{}, nil
+}
+
+// handleAlert stores, broadcasts and notifies msg; used for alerts from
+// clients as well as those raised by the server itself
+func handleAlert(msg *proto.Alert) {
+	if seen.add(msg.Id) {
+		l.Printf("ignoring duplicate alert %s from %s\n", msg.Id, msg.From.GetHostname())
+		return
+	}
+
+	a := &storedAlert{msgFormat: *newMsg(msg), Received: time.Now()}
+	initState(a)
+	a.SilencedBy = silencedBy(&a.msgFormat, a.Received)
+	a.Count, a.LastSeen = 1, &a.Received
+
+	// persist it so that it can be queried later. If the same problem
+	// is already open, it's merged into that alert.
+	stored, res, err := db.add(a)
+	if err != nil {
+		l.Printf("could not store alert %s: %v\n", msg.Id, err)
+		stored, res = a, addedNew
+	}
+	if res == addedDuplicate {
+		// seen before the server restarted
+		l.Printf("ignoring duplicate alert %s from %s\n", msg.Id, msg.From.GetHostname())
+		return
+	}
+
 	// log msg to file..
-	info := fmt.Sprintf("%-23s %-16s %s", msg.Id, msg.From.Hostname, msg.Msg.Short)
+	info := fmt.Sprintf("%-23s %-16s %-8s %s", msg.Id, msg.From.Hostname, msg.Severity, msg.Msg.Short)
+	if msg.Status == proto.Status_RESOLVED {
+		info += fmt.Sprintf(" (resolves %s)", msg.RefId)
+	}
 	l.Printf("%s\n", info)
 
-	// send the received alert/msg to all ws connections
-	pushmsg(msg)
-	return &proto.Void{}, nil
+	alertsReceived.inc("severity", msg.Severity.String(), "status", fmt.Sprint(int32(msg.Status)))
+	recordMetrics(msg.From.Hostname, msg.From.TaskName, msg.Metrics)
+
+	switch {
+	case a.SilencedBy != "":
+		l.Printf("%-23s silenced by %s\n", msg.Id, a.SilencedBy)
+	case res == addedMerged:
+		// repeat of a problem that is already known; just update it
+		l.Printf("%-23s merged into %s (count: %d)\n", msg.Id, stored.ID, stored.Count)
+		m := stored.msgFormat
+		m.Update = true
+		pushmsg(&m)
+	default:
+		// send the received alert/msg to all ws connections
+		pushmsg(&stored.msgFormat)
+		notify(&stored.msgFormat)
+	}
+
+	if msg.Status == proto.Status_RESOLVED {
+		// close the alerts raised for the task
+		resolveTask(msg.From.Hostname, msg.From.TaskName)
+	}
+
+	recordAlert(a)
+	pushHost(msg.From.Hostname)
 }
 
-// pushmsg broadcasts msg to websocket connections
-func pushmsg(msg *proto.Alert) {
-	m := &msgFormat{
+// newMsg converts msg to the format in which it is sent to ws connections
+func newMsg(msg *proto.Alert) *msgFormat {
+	return &msgFormat{
 		Time:     msg.Msg.Time,
 		ID:       msg.Id,
 		From:     msg.From.Hostname,
 		TaskName: msg.From.TaskName,
 		Short:    msg.Msg.Short,
 		Long:     msg.Msg.Long,
-		Status:   msg.Status,
+		Status:   int32(msg.Status),
+		Severity: msg.Severity.String(),
+		RefID:    msg.RefId,
+		Labels:   msg.Labels,
+		Metrics:  toMetrics(msg.Metrics),
+
+		Fingerprint: fingerprint(msg.From.Hostname, msg.From.TaskName, msg.Labels),
 	}
+}
+
+// pushmsg broadcasts m to websocket connections
+func pushmsg(m *msgFormat) {
 	b, err := json.Marshal(m)
 	if err != nil {
 		l.Printf("failed to marshal msg: %v", err)
 		return
 	}
 
-	ws.Broadcast(b)
+	ws.Broadcast(b, m.From, m)
 }
 
 type msgFormat struct {
-	Time     string `json:"time"`
-	ID       string `json:"id"`
-	From     string `json:"from"`
-	TaskName string `json:"taskName"`
-	Short    string `json:"short"`  // short message - msg field in client config.json
-	Long     string `json:"long"`   // long message - combined output of `cmd`
-	Status   int32  `json:"status"` // 0 if success, 1 if failed
+	Time     string            `json:"time"`
+	ID       string            `json:"id"`
+	From     string            `json:"from"`
+	TaskName string            `json:"taskName"`
+	Short    string            `json:"short"`           // short message - msg field in client config.json
+	Long     string            `json:"long"`            // long message - combined output of `cmd`
+	Status   int32             `json:"status"`          // 0 if handled by actions, 1 if failed, 2 if resolved
+	Severity string            `json:"severity"`        // OK, WARNING, CRITICAL or UNKNOWN
+	RefID    string            `json:"refId,omitempty"` // ID of the alert being resolved
+	Labels   map[string]string `json:"labels,omitempty"`
+	Metrics  []metric          `json:"metrics,omitempty"` // metrics found in the output of the task
+	Replay   bool              `json:"replay,omitempty"`  // true if alert is being sent again to a newly connected client
+	Update   bool              `json:"update,omitempty"`  // true if msg is an update of an alert sent earlier, eg. it's been acknowledged
+
+	State      string     `json:"state"` // open, acknowledged or resolved
+	AckedBy    string     `json:"ackedBy,omitempty"`
+	AckedAt    *time.Time `json:"ackedAt,omitempty"`
+	ResolvedBy string     `json:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+	Note       string     `json:"note,omitempty"`
+	// who is working on the alert: whoever acknowledged it, unless it
+	// was assigned to someone else
+	Assignee   string     `json:"assignee,omitempty"`
+	AssignedBy string     `json:"assignedBy,omitempty"`
+	AssignedAt *time.Time `json:"assignedAt,omitempty"`
+
+	// ID of the silence that matched the alert when it was received
+	SilencedBy string `json:"silencedBy,omitempty"`
+	// level up to which the alert has been escalated
+	Escalation int `json:"escalation,omitempty"`
+
+	// identifies the problem the alert is about; same for repeated
+	// alerts of the same task on the same host
+	Fingerprint string     `json:"fingerprint,omitempty"`
+	Count       int        `json:"count,omitempty"`    // number of times the alert was received
+	LastSeen    *time.Time `json:"lastSeen,omitempty"` // last time the alert was received
+	// IDs of the alerts combined into this one; only in grouped notifications
+	Grouped []string `json:"grouped,omitempty"`
 }
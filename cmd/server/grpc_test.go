@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+func TestResentAlertIgnoredAfterRestart(t *testing.T) {
+	seen = newRecentIDs(10)
+	useStore(t)
+	hub := useHub(t)
+	n := &fakeNotifier{done: make(chan struct{}, 10)}
+	useReceiver(t, n)
+	s, _, err := hub.register("test", "/ws/connect", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &proto.Alert{
+		Id:       "x1",
+		From:     &proto.From{Hostname: "db-1", TaskName: "disk"},
+		Msg:      &proto.Msg{Short: "disk full"},
+		Status:   proto.Status_FAILED,
+		Severity: proto.Severity_CRITICAL,
+	}
+	handleAlert(msg)
+	<-n.done
+
+	// the IDs seen recently are lost on restart; the store is not
+	seen = newRecentIDs(10)
+	handleAlert(msg)
+
+	var alerts int
+	for _, e := range received(s) {
+		if e.alert != nil {
+			alerts++
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("got %d alerts broadcast, want 1", alerts)
+	}
+	select {
+	case <-n.done:
+		t.Error("resent alert was notified again")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lithammer/shortuuid"
+	"github.com/opxyc/wd/proto"
+)
+
+const (
+	// task name of the alerts raised when a host goes silent. Clients
+	// do not accept task names starting with "wd:", so it's never the
+	// name of a task of theirs.
+	heartbeatTask = "wd:heartbeat"
+	// how often hosts are checked for missed heartbeats
+	heartbeatCheckInterval = 10 * time.Second
+	// default number of heartbeats a host can miss before it's alerted
+	defaultMissedHeartbeats = 3
+)
+
+// heartbeatCfg decides when a host is considered silent
+type heartbeatCfg struct {
+	// number of heartbeats a host can miss before an alert is raised
+	Missed int `json:"missed"`
+}
+
+var (
+	missedHeartbeats = defaultMissedHeartbeats
+	started          = time.Now() // time at which the server started
+)
+
+func (c *heartbeatCfg) validate() error {
+	if c.Missed < 1 {
+		return errors.New("missed should be at least 1")
+	}
+	return nil
+}
+
+// silentSince returns the time after which h is considered silent.
+// Heartbeats missed while the server was down are not counted, as
+// clients could not have sent them anyway.
+func (h *host) silentSince() time.Time {
+	from := h.LastSeen
+	if from.Before(started) {
+		from = started
+	}
+	return from.Add(time.Duration(h.Interval) * time.Duration(missedHeartbeats))
+}
+
+func (pbSrv) SendHeartbeat(ctx context.Context, hb *proto.Heartbeat) (*proto.Void, error) {
+	if hb.Hostname == "" || hb.Interval <= 0 {
+		return nil, errors.New("heartbeat should have hostname and interval")
+	}
+	if err := checkHostname(ctx, hb.Hostname); err != nil {
+		reject(ctx, "SendHeartbeat", hb.Hostname, err)
+		return nil, err
+	}
+
+	hostsMu.Lock()
+	h, known := hosts[hb.Hostname]
+	if !known {
+		l.Printf("new host %s (version %s, %d tasks)\n", hb.Hostname, hb.Version, len(hb.Tasks))
+		h = &host{Hostname: hb.Hostname}
+		hosts[hb.Hostname] = h
+	}
+	changed := !known || h.Version != hb.Version || h.ConfigSum != hb.ConfigChecksum
+	if known && changed {
+		l.Printf("host %s changed: version %s, config %.8s\n", hb.Hostname, hb.Version, hb.ConfigChecksum)
+	}
+	h.Version, h.ConfigSum = hb.Version, hb.ConfigChecksum
+	h.Interval = duration(time.Duration(hb.Interval) * time.Second)
+	h.Tasks = hostTasks(hb.Tasks, h.Tasks)
+	h.LastSeen = time.Now()
+	silentAlert := h.SilentAlert
+	h.SilentAlert = ""
+
+	// LastSeen of hosts is saved along with the periodic check, but
+	// other changes are saved right away
+	if changed || silentAlert != "" {
+		if err := unlockAndSave(h); err != nil {
+			l.Printf("could not save host %s: %v\n", hb.Hostname, err)
+		}
+	} else {
+		hostsMu.Unlock()
+	}
+
+	if silentAlert != "" {
+		l.Printf("host %s is back\n", hb.Hostname)
+		a := heartbeatAlert(hb.Hostname, "host is sending heartbeats again", "", proto.Status_RESOLVED, proto.Severity_OK)
+		a.RefId = silentAlert
+		// pushes the host as well
+		handleAlert(a)
+	} else if changed {
+		pushHost(hb.Hostname)
+	}
+	return &proto.Void{}, nil
+}
+
+// hostTasks converts tasks in a heartbeat to those of a host, keeping the
+// last alerts of tasks from prev
+func hostTasks(tasks []*proto.TaskInfo, prev []*hostTask) []*hostTask {
+	last := map[string]*lastAlert{}
+	for _, t := range prev {
+		last[t.Name] = t.LastAlert
+	}
+	hts := make([]*hostTask, 0, len(tasks))
+	for _, t := range tasks {
+		hts = append(hts, &hostTask{
+			Name:      t.Name,
+			Interval:  duration(time.Duration(t.Interval) * time.Second),
+			Schedule:  t.Schedule,
+			LastAlert: last[t.Name],
+		})
+	}
+	return hts
+}
+
+// checkHeartbeats checks hosts for missed heartbeats every
+// heartbeatCheckInterval until ctx is done
+func checkHeartbeats(ctx context.Context) {
+	t := time.NewTicker(heartbeatCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			checkHosts(now)
+		}
+	}
+}
+
+// checkHosts raises an alert for each host that has gone silent and saves
+// the hosts to the store
+func checkHosts(now time.Time) {
+	var silent []*proto.Alert
+
+	hostsMu.Lock()
+	hs := make([]*host, 0, len(hosts))
+	for _, h := range hosts {
+		if h.SilentAlert == "" && now.After(h.silentSince()) {
+			long := fmt.Sprintf("no heartbeat since %s (expected every %v)", h.LastSeen.Format(time.RFC3339), time.Duration(h.Interval))
+			a := heartbeatAlert(h.Hostname, "host went silent", long, proto.Status_FAILED, proto.Severity_CRITICAL)
+			h.SilentAlert = a.Id
+			silent = append(silent, a)
+			l.Printf("host %s went silent; %s\n", h.Hostname, long)
+		}
+		hs = append(hs, h)
+	}
+	if len(hs) == 0 {
+		hostsMu.Unlock()
+	} else if err := unlockAndSave(hs...); err != nil {
+		l.Printf("could not save hosts: %v\n", err)
+	}
+
+	for _, a := range silent {
+		// pushes the host as well
+		handleAlert(a)
+	}
+}
+
+// heartbeatAlert creates an alert about the heartbeats of hostname, as
+// if it was sent by the host itself
+func heartbeatAlert(hostname, short, long string, status proto.Status, sev proto.Severity) *proto.Alert {
+	return &proto.Alert{
+		Id:       shortuuid.New(),
+		From:     &proto.From{Hostname: hostname, TaskName: heartbeatTask},
+		Msg:      &proto.Msg{Short: short, Long: long, Time: time.Now().Format("2006-Jan-02 15:04:05")},
+		Status:   status,
+		Severity: sev,
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+func TestHeartbeatAlertApartFromTasks(t *testing.T) {
+	seen = newRecentIDs(100)
+	useStore(t)
+	useHub(t)
+	useReceiver(t, &fakeNotifier{})
+	old := hosts
+	hosts = map[string]*host{"db-1": {Hostname: "db-1", Interval: duration(time.Second), LastSeen: time.Now()}}
+	t.Cleanup(func() { hosts = old })
+
+	// a task of the client that happens to be called heartbeat
+	task := func(id string, st proto.Status) *proto.Alert {
+		return &proto.Alert{
+			Id:     id,
+			From:   &proto.From{Hostname: "db-1", TaskName: "heartbeat"},
+			Msg:    &proto.Msg{Short: "heartbeat task"},
+			Status: st,
+		}
+	}
+	openTasks := func() []string {
+		t.Helper()
+		open, err := db.open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tasks []string
+		for _, a := range open {
+			tasks = append(tasks, a.TaskName)
+		}
+		return tasks
+	}
+
+	checkHosts(time.Now().Add(time.Hour))
+	handleAlert(task("t1", proto.Status_FAILED))
+	handleAlert(task("t2", proto.Status_RESOLVED))
+	if got := openTasks(); len(got) != 1 || got[0] != heartbeatTask {
+		t.Fatalf("got open alerts of %v, want only the silent host alert", got)
+	}
+
+	handleAlert(task("t3", proto.Status_FAILED))
+	if _, err := removeHost("db-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := openTasks(); len(got) != 1 || got[0] != "heartbeat" {
+		t.Errorf("after removing host: got open alerts of %v, want only that of the task", got)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var hostsBucket = []byte("hosts") // hostname -> host
+
+const (
+	healthOK      = "ok"      // no open alerts
+	healthFailing = "failing" // has open alerts
+	healthSilent  = "silent"  // stopped sending heartbeats
+)
+
+// host is a client known to the server through its heartbeats
+type host struct {
+	Hostname  string      `json:"hostname"`
+	Version   string      `json:"version"`
+	ConfigSum string      `json:"configChecksum"`
+	Tasks     []*hostTask `json:"tasks"`
+	Interval  duration    `json:"interval"` // time between heartbeats
+	LastSeen  time.Time   `json:"lastSeen"`
+	// ID of the alert raised when the host went silent; empty if it's not silent
+	SilentAlert string `json:"silentAlert,omitempty"`
+
+	// filled in only when the host is sent out; see view
+	Health     string `json:"health,omitempty"`
+	OpenAlerts int    `json:"openAlerts"`
+}
+
+// hostTask is a task in the config of a host
+type hostTask struct {
+	Name      string     `json:"name"`
+	Interval  duration   `json:"interval,omitempty"`
+	Schedule  string     `json:"schedule,omitempty"`
+	LastAlert *lastAlert `json:"lastAlert,omitempty"`
+
+	// filled in by view
+	State string `json:"state,omitempty"` // ok or failing
+	*runStats
+}
+
+// lastAlert is the gist of the last alert received for a task
+type lastAlert struct {
+	ID       string    `json:"id"`
+	Received time.Time `json:"received"`
+	Status   int32     `json:"status"`
+	Severity string    `json:"severity"`
+	Short    string    `json:"short"`
+}
+
+// hostMsg is how hosts are sent to websocket connections. It is sent
+// whenever the inventory of a host or its health changes.
+type hostMsg struct {
+	Host    *host `json:"host"`
+	Removed bool  `json:"removed,omitempty"` // true if the host was removed from inventory
+}
+
+var (
+	hostsMu sync.Mutex
+	hosts   = map[string]*host{}
+)
+
+// loadHosts reads the hosts saved in the store, so that hosts that went
+// silent while the server was down are noticed
+func loadHosts() error {
+	return db.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(hostsBucket).ForEach(func(k, v []byte) error {
+			h := &host{}
+			if err := json.Unmarshal(v, h); err != nil {
+				return err
+			}
+			hosts[h.Hostname] = h
+			return nil
+		})
+	})
+}
+
+// hostsSaveMu makes saves of hosts happen in the order of the changes,
+// without holding hostsMu during the write
+var hostsSaveMu sync.Mutex
+
+// unlockAndSave saves copies of hs to the store. It's called with hostsMu
+// held, which it releases before writing.
+func unlockAndSave(hs ...*host) error {
+	copies := make([]*host, len(hs))
+	for i, h := range hs {
+		copies[i] = copyHost(h)
+	}
+	hostsSaveMu.Lock()
+	defer hostsSaveMu.Unlock()
+	hostsMu.Unlock()
+	return saveHosts(copies...)
+}
+
+// saveHosts saves hs to the store
+func saveHosts(hs ...*host) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(hostsBucket)
+		for _, h := range hs {
+			v, err := json.Marshal(h)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(h.Hostname), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteHost removes the host with given name from the store
+func deleteHost(name string) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(hostsBucket).Delete([]byte(name))
+	})
+}
+
+// copyHost returns a copy of h that can be used without holding hostsMu
+func copyHost(h *host) *host {
+	c := *h
+	c.Tasks = make([]*hostTask, len(h.Tasks))
+	for i, t := range h.Tasks {
+		ct := *t
+		c.Tasks[i] = &ct
+	}
+	return &c
+}
+
+// view returns copies of hs with health and task states filled in from
+// the open alerts
+func view(hs []*host) ([]*host, error) {
+	// host -> task -> number of open alerts; hostnames don't change, so
+	// they can be read without hostsMu
+	open := make(map[string]map[string]int, len(hs))
+	for _, h := range hs {
+		tasks, err := db.openTasks(h.Hostname)
+		if err != nil {
+			return nil, err
+		}
+		open[h.Hostname] = tasks
+	}
+
+	now := time.Now()
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	views := make([]*host, 0, len(hs))
+	for _, h := range hs {
+		v := copyHost(h)
+		for _, n := range open[v.Hostname] {
+			v.OpenAlerts += n
+		}
+		switch {
+		case v.SilentAlert != "":
+			v.Health = healthSilent
+		case v.OpenAlerts > 0:
+			v.Health = healthFailing
+		default:
+			v.Health = healthOK
+		}
+		for _, t := range v.Tasks {
+			t.runStats = runStatsOf(v.Hostname, t.Name, now)
+			t.State = healthOK
+			if open[v.Hostname][t.Name] > 0 {
+				t.State = healthFailing
+			}
+		}
+		views = append(views, v)
+	}
+	return views, nil
+}
+
+// recordAlert notes a as the last alert of its task, if the host is known
+func recordAlert(a *storedAlert) {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	h, ok := hosts[a.From]
+	if !ok {
+		return
+	}
+	for _, t := range h.Tasks {
+		if t.Name == a.TaskName {
+			t.LastAlert = &lastAlert{ID: a.ID, Received: a.Received, Status: a.Status, Severity: a.Severity, Short: a.Short}
+			return
+		}
+	}
+}
+
+// pushHost broadcasts the host with given name to websocket connections,
+// if it's known
+func pushHost(name string) {
+	hostsMu.Lock()
+	h, ok := hosts[name]
+	hostsMu.Unlock()
+	if !ok {
+		return
+	}
+	views, err := view([]*host{h})
+	if err != nil {
+		l.Printf("could not look up health of host %s: %v\n", name, err)
+		return
+	}
+	broadcastHost(&hostMsg{Host: views[0]})
+}
+
+func broadcastHost(m *hostMsg) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		l.Printf("failed to marshal msg: %v", err)
+		return
+	}
+	ws.Broadcast(b, m.Host.Hostname, nil)
+}
+
+// hostsHandler handles:
+//
+//	GET    /hosts
+//	GET    /hosts/{name}
+//	DELETE /hosts/{name} - removes a decommissioned host from inventory
+func hostsHandler(r *http.Request) (interface{}, error) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/hosts"), "/")
+	switch {
+	case name != "" && !userFrom(r).canSee(name):
+		return nil, &apiError{http.StatusNotFound, "host not found"}
+	case name == "" && r.Method == http.MethodGet:
+		return listHosts(userFrom(r))
+	case name != "" && r.Method == http.MethodGet:
+		hostsMu.Lock()
+		h, ok := hosts[name]
+		hostsMu.Unlock()
+		if !ok {
+			return nil, &apiError{http.StatusNotFound, "host not found"}
+		}
+		views, err := view([]*host{h})
+		if err != nil {
+			return nil, err
+		}
+		return views[0], nil
+	case name != "" && r.Method == http.MethodDelete:
+		return removeHost(name)
+	}
+	return nil, errMethod(r.Method)
+}
+
+// listHosts returns the known hosts that u can see, sorted by name
+func listHosts(u *user) (interface{}, error) {
+	hostsMu.Lock()
+	hs := make([]*host, 0, len(hosts))
+	for _, h := range hosts {
+		if u.canSee(h.Hostname) {
+			hs = append(hs, h)
+		}
+	}
+	hostsMu.Unlock()
+
+	views, err := view(hs)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Hostname < views[j].Hostname
+	})
+	return struct {
+		Hosts []*host `json:"hosts"`
+	}{views}, nil
+}
+
+// removeHost forgets the host with given name, resolving the alert raised
+// if it went silent. If it's still running, it's added back on its next heartbeat.
+func removeHost(name string) (interface{}, error) {
+	hostsMu.Lock()
+	h, ok := hosts[name]
+	if !ok {
+		hostsMu.Unlock()
+		return nil, &apiError{http.StatusNotFound, "host not found"}
+	}
+	delete(hosts, name)
+	h = copyHost(h)
+	hostsSaveMu.Lock()
+	hostsMu.Unlock()
+	err := deleteHost(name)
+	hostsSaveMu.Unlock()
+	if err != nil {
+		hostsMu.Lock()
+		if _, back := hosts[name]; !back {
+			hosts[name] = h
+		}
+		hostsMu.Unlock()
+		return nil, err
+	}
+
+	deleteMetrics(name)
+	if err := deleteStats(name); err != nil {
+		l.Printf("could not delete results of host %s: %v\n", name, err)
+	}
+	l.Printf("host %s removed from inventory\n", name)
+	if h.SilentAlert != "" {
+		// it's not coming back
+		resolveTask(name, heartbeatTask)
+	}
+	broadcastHost(&hostMsg{Host: h, Removed: true})
+	return h, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+// states of an alert. An alert moves from open to acknowledged
+// to resolved; it can also be resolved without being acknowledged.
+const (
+	stateOpen     = "open"
+	stateAcked    = "acknowledged"
+	stateResolved = "resolved"
+)
+
+var errInvalidTransition = errors.New("invalid state transition")
+
+// initState sets the state in which an alert starts, as received from a client
+func initState(a *storedAlert) {
+	switch proto.Status(a.Status) {
+	case proto.Status_FAILED:
+		a.State = stateOpen
+	default:
+		// handled by actions or a resolved msg itself; nothing to be done
+		a.State = stateResolved
+		a.ResolvedBy = a.From
+		a.ResolvedAt = &a.Received
+	}
+}
+
+// ack acknowledges a, recording who did it
+func ack(a *storedAlert, by, note string, at time.Time) error {
+	if a.State != stateOpen {
+		return errInvalidTransition
+	}
+	a.State = stateAcked
+	a.AckedBy, a.AckedAt = by, &at
+	if a.Assignee == "" {
+		a.Assignee = by
+	}
+	if note != "" {
+		a.Note = note
+	}
+	return nil
+}
+
+// assignTo returns a transition that makes to the assignee of an alert
+// that is not resolved yet, recording who did it. The state of the alert
+// is left as it is; to acknowledges it once they're on it.
+func assignTo(to string) func(a *storedAlert, by, note string, at time.Time) error {
+	return func(a *storedAlert, by, note string, at time.Time) error {
+		if a.State != stateOpen && a.State != stateAcked {
+			return errInvalidTransition
+		}
+		a.Assignee = to
+		a.AssignedBy, a.AssignedAt = by, &at
+		if note != "" {
+			a.Note = note
+		}
+		return nil
+	}
+}
+
+// resolve resolves a, recording who did it
+func resolve(a *storedAlert, by, note string, at time.Time) error {
+	if a.State != stateOpen && a.State != stateAcked {
+		return errInvalidTransition
+	}
+	a.State = stateResolved
+	a.ResolvedBy, a.ResolvedAt = by, &at
+	if note != "" {
+		a.Note = note
+	}
+	return nil
+}
+
+// transition applies f to the stored alert with given id and
+// broadcasts the updated alert. what is logged as what was done.
+func transition(id, what string, f func(a *storedAlert, by, note string, at time.Time) error, by, note string) (*storedAlert, error) {
+	a, err := db.update(id, func(a *storedAlert) error {
+		return f(a, by, note, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.Printf("%-23s %s by %s\n", id, what, by)
+
+	if a.SilencedBy == "" {
+		m := a.msgFormat
+		m.Update = true
+		pushmsg(&m)
+	}
+	return a, nil
+}
+
+// resolveTask resolves all open alerts of task on host; used when
+// the client reports that the task has started passing again
+func resolveTask(host, task string) {
+	open, err := db.open()
+	if err != nil {
+		l.Printf("could not look up open alerts: %v\n", err)
+		return
+	}
+	for _, a := range open {
+		if a.From != host || a.TaskName != task {
+			continue
+		}
+		if _, err := transition(a.ID, stateResolved, resolve, host, ""); err != nil {
+			l.Printf("could not resolve alert %s: %v\n", a.ID, err)
+		}
+	}
+}
+
+// alertHandler handles requests on a single alert:
+//
+//	GET  /alerts/{id}
+//	POST /alerts/{id}/ack     {"by": "who", "note": "optional note"}
+//	POST /alerts/{id}/resolve {"by": "who", "note": "optional note"}
+//	POST /alerts/{id}/assign  {"by": "who", "to": "assignee", "note": "optional note"}
+func alertHandler(r *http.Request) (interface{}, error) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/alerts/"), "/")
+	id := parts[0]
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			return nil, errMethod(r.Method)
+		}
+		a, err := db.get(id)
+		if err == errNotFound || (err == nil && !userFrom(r).canSee(a.From)) {
+			return nil, &apiError{http.StatusNotFound, fmt.Sprintf("alert %s not found", id)}
+		}
+		return a, err
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	if action != "ack" && action != "resolve" && action != "assign" {
+		return nil, &apiError{http.StatusNotFound, "not found"}
+	}
+	if r.Method != http.MethodPost {
+		return nil, errMethod(r.Method)
+	}
+
+	var body struct {
+		By   string `json:"by"`
+		To   string `json:"to"` // for assign
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid body: %v", err)
+	}
+	if u := userFrom(r); u != nil {
+		// it's whoever is logged in
+		body.By = u.Name
+	}
+	if body.By == "" {
+		return nil, errors.New("by is required")
+	}
+	a, err := db.get(id)
+	if err == nil && !userFrom(r).canSee(a.From) {
+		return nil, &apiError{http.StatusNotFound, fmt.Sprintf("alert %s not found", id)}
+	}
+
+	var f func(a *storedAlert, by, note string, at time.Time) error
+	what := ""
+	switch action {
+	case "ack":
+		f, what = ack, stateAcked
+	case "resolve":
+		f, what = resolve, stateResolved
+	case "assign":
+		if body.To == "" {
+			return nil, &apiError{http.StatusBadRequest, "to is required"}
+		}
+		if err == nil && users != nil {
+			// it should be someone who can act on it
+			if to := findUser(body.To); to == nil || !to.canSee(a.From) || !to.can(scopeAcknowledger) {
+				return nil, &apiError{http.StatusBadRequest, fmt.Sprintf("alert %s cannot be assigned to %s", id, body.To)}
+			}
+		}
+		f, what = assignTo(body.To), "assigned to "+body.To
+	}
+
+	a, err = transition(id, what, f, body.By, body.Note)
+	switch err {
+	case errNotFound:
+		return nil, &apiError{http.StatusNotFound, fmt.Sprintf("alert %s not found", id)}
+	case errInvalidTransition:
+		return nil, &apiError{http.StatusConflict, fmt.Sprintf("cannot %s alert %s in its current state", action, id)}
+	}
+	if err == nil && a.State == stateResolved {
+		// health of the host may have changed
+		pushHost(a.From)
+	}
+	return a, err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAssign(t *testing.T) {
+	useStore(t)
+	hub := useHub(t)
+	alice := newUser("alice", scopeAcknowledger, "db-*")
+	useUsers(t,
+		alice,
+		newUser("bob", scopeAcknowledger, "db-*"),
+		newUser("carol", scopeViewer, "db-*"),
+		newUser("dave", scopeAcknowledger, "web-*"),
+	)
+	if _, _, err := db.add(newStored("a1", "db-1", "disk")); err != nil {
+		t.Fatal(err)
+	}
+	s, _, err := hub.register("test", "/ws/connect", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(action, body string) (*storedAlert, error) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/alerts/a1/"+action, strings.NewReader(body))
+		v, err := alertHandler(asUser(r, alice))
+		a, _ := v.(*storedAlert)
+		return a, err
+	}
+	status := func(err error) int {
+		if e, ok := err.(*apiError); ok {
+			return e.code
+		}
+		return 0
+	}
+
+	// whoever acknowledges it is on it
+	a, err := post("ack", `{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Assignee != "alice" {
+		t.Errorf("ack: got assignee %q, want alice", a.Assignee)
+	}
+
+	a, err = post("assign", `{"to": "bob", "note": "yours"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Assignee != "bob" || a.AssignedBy != "alice" || a.AssignedAt == nil || a.State != stateAcked || a.Note != "yours" {
+		t.Errorf("assign: got assignee %q by %q in state %s, note %q; want bob by alice, acknowledged", a.Assignee, a.AssignedBy, a.State, a.Note)
+	}
+	events := received(s)
+	if len(events) != 2 || !events[1].alert.Update || events[1].alert.Assignee != "bob" {
+		t.Errorf("got %d msgs broadcast, want the ack and the assignment as updates", len(events))
+	}
+
+	// only to those who can act on it
+	for _, to := range []string{"", "carol", "dave", "nobody"} {
+		if _, err := post("assign", `{"to": "`+to+`"}`); status(err) != http.StatusBadRequest {
+			t.Errorf("assign to %q: got %v, want status 400", to, err)
+		}
+	}
+
+	if _, err := post("resolve", `{}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := post("assign", `{"to": "bob"}`); status(err) != http.StatusConflict {
+		t.Errorf("assign resolved alert: got %v, want status 409", err)
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -15,12 +18,24 @@ import (
 var (
 	ws *WS         // websocket	handler
 	l  *log.Logger // logger
+	db *store      // alert store
 )
 
 func main() {
+	if runSubcommand(os.Args[1:]) {
+		return
+	}
+
 	gRPCSrvAddr := flag.String("grpc-addr", ":40090", "network address addr on which gRPC server should listen on")
 	httpAddr := flag.String("http-addr", ":40080", "network address addr on which http server should listen on")
 	dir := flag.String("l", "log", "log directory")
+	dbPath := flag.String("db", "wd.db", "path to the file in which alerts are stored")
+	retention := flag.Duration("retention", 0, "how long resolved alerts are kept in the store; 0 keeps them forever")
+	cfgPath := flag.String("c", "", "path to config file")
+	tlsCert := flag.String("tls-cert", "", "path to TLS certificate for gRPC server; gRPC is served in plaintext if not given")
+	tlsKey := flag.String("tls-key", "", "path to key of TLS certificate")
+	tokensFile := flag.String("tokens", "", "path to file with tokens clients should authenticate with; clients are not authenticated if not given")
+	tlsCA := flag.String("tls-ca", "", "path to CA certificate(s) that client certificates should be signed by; if given, clients should present a certificate with their hostname as CN")
 	flag.Parse()
 
 	// set up logger
@@ -34,14 +49,107 @@ func main() {
 		log.Fatalf("could not set logger #2: %v\n", err)
 	}
 
-	go gRPCServer(*gRPCSrvAddr)
-	go websocketServer(*httpAddr, "/ws/connect", l)
+	audit, err = logger.NewDailyLogger(ctx, filepath.Join(*dir, "audit"), logFileNameFormat, 00, 00)
+	if err != nil {
+		log.Fatalf("could not set audit logger: %v\n", err)
+	}
+	if *tokensFile != "" {
+		if err := loadTokens(*tokensFile); err != nil {
+			l.Fatalf("could not read tokens: %v\n", err)
+		}
+		go watchTokens(ctx)
+	}
+
+	var tlsCfg *tls.Config
+	if *tlsCert != "" || *tlsKey != "" {
+		tlsCfg, err = serverTLS(*tlsCert, *tlsKey, *tlsCA)
+		if err != nil {
+			l.Fatalf("could not set up TLS: %v\n", err)
+		}
+		pinHostnames = *tlsCA != ""
+	} else if *tlsCA != "" {
+		l.Fatalf("-tls-ca needs -tls-cert and -tls-key\n")
+	}
 
-	// wait for signal
+	cfg, err := readConfig(*cfgPath)
+	if err != nil {
+		l.Fatalf("could not read config: %v\n", err)
+	}
+	if err := setupReceivers(ctx, cfg.Receivers, *dir); err != nil {
+		l.Fatalf("could not set up receivers: %v\n", err)
+	}
+	if err := validateRoutes(cfg.Routes, ""); err != nil {
+		l.Fatalf("invalid routes: %v\n", err)
+	}
+	routes = cfg.Routes
+	if err := validateEscalations(cfg.Escalations); err != nil {
+		l.Fatalf("invalid escalations: %v\n", err)
+	}
+	escalations = cfg.Escalations
+	if cfg.Group != nil {
+		if err := cfg.Group.validate(); err != nil {
+			l.Fatalf("invalid group: %v\n", err)
+		}
+		grouping = cfg.Group
+	}
+	if cfg.Heartbeat != nil {
+		if err := cfg.Heartbeat.validate(); err != nil {
+			l.Fatalf("invalid heartbeat: %v\n", err)
+		}
+		missedHeartbeats = cfg.Heartbeat.Missed
+	}
+	if err := validateUsers(cfg.Users); err != nil {
+		l.Fatalf("invalid users: %v\n", err)
+	}
+	if len(cfg.Users) > 0 {
+		users = cfg.Users
+	}
+	allowedOrigins = cfg.AllowedOrigins
+
+	db, err = openStore(*dbPath)
+	if err != nil {
+		l.Fatalf("could not open alert store: %v\n", err)
+	}
+	defer db.Close()
+	if err := loadHosts(); err != nil {
+		l.Fatalf("could not load hosts: %v\n", err)
+	}
+	if err := loadStats(); err != nil {
+		l.Fatalf("could not load task results: %v\n", err)
+	}
+
+	http.Handle("/alerts", authorized(scopeViewer, scopeViewer, apiHandler(listAlerts)))
+	http.Handle("/alerts/", authorized(scopeViewer, scopeAcknowledger, apiHandler(alertHandler)))
+	http.Handle("/alerts/wait", authorized(scopeViewer, scopeViewer, apiHandler(waitHandler)))
+	http.Handle("/silences", authorized(scopeViewer, scopeAdmin, apiHandler(silencesHandler)))
+	http.Handle("/silences/", authorized(scopeViewer, scopeAdmin, apiHandler(silencesHandler)))
+	http.Handle("/hosts", authorized(scopeViewer, scopeAdmin, apiHandler(hostsHandler)))
+	http.Handle("/hosts/", authorized(scopeViewer, scopeAdmin, apiHandler(hostsHandler)))
+	http.Handle("/metrics", authorized(scopeViewer, scopeViewer, http.HandlerFunc(metricsHandler)))
+	http.Handle("/session", authorized(scopeViewer, scopeViewer, apiHandler(sessionHandler)))
+
+	// created before starting the gRPC server, which broadcasts through it
+	ws = New(*httpAddr, "/ws/connect", l)
+	http.Handle("/events", authorized(scopeViewer, scopeViewer, connectHandler(ws, eventsHandler)))
+
+	go gRPCServer(*gRPCSrvAddr, tlsCfg)
+	go escalate(ctx)
+	go checkHeartbeats(ctx)
+	if *retention > 0 {
+		go pruneAlerts(ctx, *retention)
+	}
+	go websocketServer(ws)
+
+	// wait for signal; SIGHUP reloads tokens
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
-	signal.Notify(sigChan, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGHUP)
 	signalReceived := <-sigChan
+	for ; signalReceived == syscall.SIGHUP; signalReceived = <-sigChan {
+		if *tokensFile != "" {
+			reloadTokens()
+		}
+	}
 	l.Printf("Received '%v', attempting graceful termination\n", signalReceived)
 	tc, cf := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cf()
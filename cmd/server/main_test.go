@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	l = log.New(io.Discard, "", 0)
+	audit = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// useStore makes db a new empty store for the duration of the test
+func useStore(t *testing.T) {
+	t.Helper()
+	s, err := openStore(filepath.Join(t.TempDir(), "wd.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.db.NoSync = true
+	db = s
+	t.Cleanup(func() {
+		s.Close()
+		db = nil
+	})
+}
+
+// useHub makes ws a new hub for the duration of the test
+func useHub(t *testing.T) *WS {
+	ws = New("", "/ws/connect", l)
+	t.Cleanup(func() { ws = nil })
+	return ws
+}
+
+// received returns the msgs queued for s so far
+func received(s *subscriber) []*event {
+	var events []*event
+	for {
+		select {
+		case e, ok := <-s.send:
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+// fakeNotifier records the alerts it's asked to send
+type fakeNotifier struct {
+	mu   sync.Mutex
+	sent []*msgFormat
+	done chan struct{}
+}
+
+func (n *fakeNotifier) notify(ctx context.Context, a *msgFormat) error {
+	n.mu.Lock()
+	n.sent = append(n.sent, a)
+	n.mu.Unlock()
+	if n.done != nil {
+		n.done <- struct{}{}
+	}
+	return nil
+}
+
+// useReceiver makes n the only receiver for the duration of the test
+func useReceiver(t *testing.T, n notifier) {
+	old := receivers
+	receivers = map[string]*receiver{"test": {name: "test", n: n, fl: l}}
+	t.Cleanup(func() { receivers = old })
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/opxyc/wd/proto"
+)
+
+// matcher matches alerts by the host and task that raised them, their
+// severity, status and labels. Empty fields match everything.
+type matcher struct {
+	Host     string            `json:"host,omitempty"`     // glob, eg. "db-*"
+	Task     string            `json:"task,omitempty"`     // glob
+	Severity []string          `json:"severity,omitempty"` // any of them
+	Status   statuses          `json:"status,omitempty"`   // any of them
+	Labels   map[string]string `json:"labels,omitempty"`   // all of them should be present on the alert
+}
+
+// statuses are alert statuses, which can be given in JSON as numbers
+// or as names, eg. 1 or "FAILED"
+type statuses []int32
+
+func (s *statuses) UnmarshalJSON(b []byte) error {
+	var vs []json.RawMessage
+	if err := json.Unmarshal(b, &vs); err != nil {
+		return err
+	}
+	*s = make(statuses, 0, len(vs))
+	for _, v := range vs {
+		var name string
+		if err := json.Unmarshal(v, &name); err != nil {
+			// not a name
+			name = string(v)
+		}
+		n, err := parseStatus(name)
+		if err != nil {
+			return err
+		}
+		*s = append(*s, n)
+	}
+	return nil
+}
+
+// parseStatus parses an alert status given as a number or a name
+func parseStatus(v string) (int32, error) {
+	if n, ok := proto.Status_value[v]; ok {
+		return n, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid status %q", v)
+	}
+	return int32(n), nil
+}
+
+// match reports whether m matches a
+func (m *matcher) match(a *msgFormat) bool {
+	if !globMatch(m.Host, a.From) || !globMatch(m.Task, a.TaskName) {
+		return false
+	}
+	if len(m.Severity) > 0 && !containsStr(m.Severity, a.Severity) {
+		return false
+	}
+	if len(m.Status) > 0 && !containsInt32(m.Status, a.Status) {
+		return false
+	}
+	for k, v := range m.Labels {
+		if a.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// validate checks that the globs and severities in m are valid
+func (m *matcher) validate() error {
+	for _, p := range []string{m.Host, m.Task} {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", p)
+		}
+	}
+	for _, s := range m.Severity {
+		if _, ok := proto.Severity_value[s]; !ok {
+			return fmt.Errorf("invalid severity %q", s)
+		}
+	}
+	return nil
+}
+
+// String returns the non empty fields of m
+func (m *matcher) String() string {
+	var f []string
+	if m.Host != "" {
+		f = append(f, "host="+m.Host)
+	}
+	if m.Task != "" {
+		f = append(f, "task="+m.Task)
+	}
+	if len(m.Severity) > 0 {
+		f = append(f, fmt.Sprintf("severity=%v", m.Severity))
+	}
+	if len(m.Status) > 0 {
+		f = append(f, fmt.Sprintf("status=%v", m.Status))
+	}
+	if len(m.Labels) > 0 {
+		f = append(f, fmt.Sprintf("labels=%v", m.Labels))
+	}
+	if len(f) == 0 {
+		return "*"
+	}
+	return strings.Join(f, " ")
+}
+
+// globMatch reports whether s matches the glob pattern; empty pattern matches everything
+func globMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+func containsStr(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt32(list []int32, n int32) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+// metric is a named value reported by a task
+type metric struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+}
+
+// taskMetric is the latest value of a metric reported by a task
+type taskMetric struct {
+	metric
+	host, task string
+	updated    time.Time
+}
+
+const (
+	// metrics of a task that are not reported again for this many runs
+	// of it are dropped; eg. those reported by a failing task that is
+	// passing now, if its results are not sent
+	metricMaxAge = 3
+	// age after which metrics of tasks whose interval is not known (eg.
+	// those that run on a schedule) are dropped
+	defaultMetricTTL = 15 * time.Minute
+)
+
+// counter is a set of monotonically increasing values, one per set of labels
+type counter struct {
+	mu sync.Mutex
+	v  map[string]float64 // rendered labels -> value
+}
+
+func newCounter() *counter {
+	return &counter{v: map[string]float64{}}
+}
+
+// inc increments the value for labels, given as name, value pairs
+func (c *counter) inc(labels ...string) {
+	k := renderLabels(labels...)
+	c.mu.Lock()
+	c.v[k]++
+	c.mu.Unlock()
+}
+
+// server internals exposed on /metrics
+var (
+	alertsReceived = newCounter() // by severity and status
+	notifications  = newCounter() // by receiver and result
+
+	taskMetricsMu sync.Mutex
+	// latest metrics reported by tasks; rendered labels -> metric
+	taskMetrics = map[string]*taskMetric{}
+)
+
+// recordMetrics keeps the latest values of metrics reported by task on host
+func recordMetrics(host, task string, ms []*proto.Metric) {
+	if len(ms) == 0 {
+		return
+	}
+	taskMetricsMu.Lock()
+	defer taskMetricsMu.Unlock()
+	for _, m := range ms {
+		k := renderLabels("host", host, "task", task, "name", m.Name, "unit", m.Unit)
+		taskMetrics[k] = &taskMetric{
+			metric:  metric{Name: m.Name, Value: m.Value, Unit: m.Unit},
+			host:    host,
+			task:    task,
+			updated: time.Now(),
+		}
+	}
+}
+
+// metricTTLs returns the time after which metrics of each task are
+// dropped, keyed by statsKey, for tasks whose interval is known
+func metricTTLs() map[string]time.Duration {
+	ttls := map[string]time.Duration{}
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	for _, h := range hosts {
+		for _, t := range h.Tasks {
+			if t.Interval > 0 {
+				ttls[statsKey(h.Hostname, t.Name)] = metricMaxAge * time.Duration(t.Interval)
+			}
+		}
+	}
+	return ttls
+}
+
+// currentMetrics returns the values of metrics reported by tasks,
+// dropping those that are too old
+func currentMetrics(now time.Time) map[string]float64 {
+	ttls := metricTTLs()
+	values := map[string]float64{}
+	taskMetricsMu.Lock()
+	defer taskMetricsMu.Unlock()
+	for k, m := range taskMetrics {
+		ttl, ok := ttls[statsKey(m.host, m.task)]
+		if !ok {
+			ttl = defaultMetricTTL
+		}
+		if now.Sub(m.updated) > ttl {
+			delete(taskMetrics, k)
+			continue
+		}
+		values[k] = m.Value
+	}
+	return values
+}
+
+// deleteMetrics forgets the metrics reported by tasks of host
+func deleteMetrics(host string) {
+	prefix := renderLabels("host", host)
+	prefix = prefix[:len(prefix)-1] + ","
+	taskMetricsMu.Lock()
+	defer taskMetricsMu.Unlock()
+	for k := range taskMetrics {
+		if strings.HasPrefix(k, prefix) {
+			delete(taskMetrics, k)
+		}
+	}
+}
+
+// toMetrics converts metrics received from a client
+func toMetrics(ms []*proto.Metric) []metric {
+	var metrics []metric
+	for _, m := range ms {
+		metrics = append(metrics, metric{Name: m.Name, Value: m.Value, Unit: m.Unit})
+	}
+	return metrics
+}
+
+// metricsHandler serves metrics in Prometheus text format
+func metricsHandler(rw http.ResponseWriter, r *http.Request) {
+	if !userFrom(r).seesAll() {
+		// metrics are not filtered by host
+		http.Error(rw, "needs access to all hosts", http.StatusForbidden)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	writeCounter(rw, "wd_alerts_received_total", "Alerts received from clients.", alertsReceived)
+	writeCounter(rw, "wd_notifications_total", "Notifications sent to receivers, by result.", notifications)
+
+	ws.mu.Lock()
+	conns := len(ws.cons)
+	ws.mu.Unlock()
+	writeFamily(rw, "wd_websocket_connections", "gauge", "Connected WebSocket clients.", map[string]float64{"": float64(conns)})
+
+	open := map[string]float64{}
+	if alerts, err := db.open(); err == nil {
+		open[""] = float64(len(alerts))
+	} else {
+		l.Printf("could not look up open alerts for metrics: %v\n", err)
+	}
+	writeFamily(rw, "wd_open_alerts", "gauge", "Alerts that are not resolved yet.", open)
+
+	lastSeen := map[string]float64{}
+	hostsMu.Lock()
+	for _, h := range hosts {
+		lastSeen[renderLabels("host", h.Hostname)] = float64(h.LastSeen.UnixNano()) / float64(time.Second)
+	}
+	hostsMu.Unlock()
+	writeFamily(rw, "wd_host_last_seen_timestamp_seconds", "gauge", "Time of the last heartbeat of a host.", lastSeen)
+
+	lastSuccess := map[string]float64{}
+	statsMu.Lock()
+	for k, st := range stats {
+		if st.LastSuccess == nil {
+			continue
+		}
+		parts := strings.SplitN(k, "\x00", 2)
+		lastSuccess[renderLabels("host", parts[0], "task", parts[1])] = float64(st.LastSuccess.UnixNano()) / float64(time.Second)
+	}
+	statsMu.Unlock()
+	writeFamily(rw, "wd_task_last_success_timestamp_seconds", "gauge", "Time of the last run of a task that passed.", lastSuccess)
+
+	writeFamily(rw, "wd_task_metric", "gauge", "Latest value of a metric reported by a task.", currentMetrics(time.Now()))
+}
+
+func writeCounter(w io.Writer, name, help string, c *counter) {
+	c.mu.Lock()
+	values := make(map[string]float64, len(c.v))
+	for k, v := range c.v {
+		values[k] = v
+	}
+	c.mu.Unlock()
+	writeFamily(w, name, "counter", help, values)
+}
+
+// writeFamily writes a metric family; values are keyed by rendered labels
+func writeFamily(w io.Writer, name, typ, help string, values map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", name, k, formatValue(values[k]))
+	}
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// renderLabels renders labels given as name, value pairs as {name="value",...}
+func renderLabels(labels ...string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
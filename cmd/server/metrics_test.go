@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+func TestTaskMetricsExpire(t *testing.T) {
+	hostsMu.Lock()
+	hosts["db-1"] = &host{Hostname: "db-1", Tasks: []*hostTask{{Name: "disk", Interval: duration(time.Minute)}}}
+	hostsMu.Unlock()
+	t.Cleanup(func() {
+		hostsMu.Lock()
+		delete(hosts, "db-1")
+		hostsMu.Unlock()
+		deleteMetrics("db-1")
+	})
+
+	recordMetrics("db-1", "disk", []*proto.Metric{{Name: "/", Value: 93, Unit: "%"}})
+	recordMetrics("db-1", "cron-job", []*proto.Metric{{Name: "rows", Value: 10}})
+	disk := renderLabels("host", "db-1", "task", "disk", "name", "/", "unit", "%")
+	cron := renderLabels("host", "db-1", "task", "cron-job", "name", "rows", "unit", "")
+
+	now := time.Now()
+	tests := []struct {
+		after      time.Duration
+		disk, cron bool
+	}{
+		{2 * time.Minute, true, true},
+		// not reported for 3 runs of disk
+		{4 * time.Minute, false, true},
+		// cron-job runs on a schedule; its interval is not known
+		{16 * time.Minute, false, false},
+	}
+	for _, tt := range tests {
+		values := currentMetrics(now.Add(tt.after))
+		if _, ok := values[disk]; ok != tt.disk {
+			t.Errorf("after %v: got disk metric %v, want %v", tt.after, ok, tt.disk)
+		}
+		if _, ok := values[cron]; ok != tt.cron {
+			t.Errorf("after %v: got cron-job metric %v, want %v", tt.after, ok, tt.cron)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/opxyc/goutils/logger"
+)
+
+const (
+	defaultRetries = 3
+	// delay before the first retry; doubled for every retry after that
+	retryDelay = 2 * time.Second
+	// time allowed for a single attempt to notify
+	notifyTimeout = 10 * time.Second
+	// max number of notifications being sent at a time, including those
+	// waiting to be retried. Notifications beyond it are dropped.
+	maxPendingNotifications = 100
+)
+
+// notifier sends an alert to some channel, eg. email
+type notifier interface {
+	notify(ctx context.Context, a *msgFormat) error
+}
+
+// receiverCfg is the config of a receiver. Exactly one of Email, Webhook and Chat should be set.
+type receiverCfg struct {
+	Name    string      `json:"name"`
+	Retries *int        `json:"retries"` // number of retries on failure; defaults to 3
+	Email   *emailCfg   `json:"email"`
+	Webhook *webhookCfg `json:"webhook"`
+	Chat    *chatCfg    `json:"chat"` // slack/mattermost incoming webhook
+}
+
+// receiver is a named notification channel
+type receiver struct {
+	name    string
+	retries int
+	n       notifier
+	// logs failures to notify
+	fl *log.Logger
+}
+
+var (
+	// receivers by name
+	receivers = map[string]*receiver{}
+	// a slot is taken by each notification being sent
+	notifySlots = make(chan struct{}, maxPendingNotifications)
+)
+
+// setupReceivers creates the receivers in cfg. Failures of each are logged
+// to a directory of its own, named after it, inside dir.
+func setupReceivers(ctx context.Context, cfgs []receiverCfg, dir string) error {
+	for _, c := range cfgs {
+		if c.Name == "" {
+			return errors.New("receiver without name")
+		}
+		if _, ok := receivers[c.Name]; ok {
+			return fmt.Errorf("duplicate receiver %q", c.Name)
+		}
+
+		var (
+			n   notifier
+			err error
+			set int
+		)
+		if c.Email != nil {
+			n, err = newEmail(c.Email)
+			set++
+		}
+		if c.Webhook != nil {
+			n, err = newWebhook(c.Webhook)
+			set++
+		}
+		if c.Chat != nil {
+			n, err = newChat(c.Chat)
+			set++
+		}
+		if set != 1 {
+			return fmt.Errorf("receiver %q: exactly one of email, webhook and chat should be given", c.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("receiver %q: %v", c.Name, err)
+		}
+
+		r := &receiver{name: c.Name, retries: defaultRetries, n: n}
+		if c.Retries != nil {
+			r.retries = *c.Retries
+		}
+		r.fl, err = logger.NewDailyLogger(ctx, filepath.Join(dir, "notify", c.Name), "2006-Jan-02", 00, 00)
+		if err != nil {
+			return fmt.Errorf("receiver %q: could not set logger: %v", c.Name, err)
+		}
+		receivers[c.Name] = r
+	}
+	return nil
+}
+
+// notify sends a, in the background, to the receivers chosen by routes
+func notify(a *msgFormat) {
+	names := receiversFor(a)
+	if len(names) == 0 {
+		return
+	}
+	l.Printf("%-23s routed to %v\n", a.ID, names)
+	for _, name := range names {
+		if grouping != nil {
+			sendGrouped(receivers[name], a)
+			continue
+		}
+		receivers[name].sendAsync(a)
+	}
+}
+
+// sendAsync sends a via r in the background, unless too many
+// notifications are being sent already
+func (r *receiver) sendAsync(a *msgFormat) {
+	select {
+	case notifySlots <- struct{}{}:
+	default:
+		l.Printf("could not notify %s of alert %s: too many notifications pending\n", r.name, a.ID)
+		notifications.inc("receiver", r.name, "result", "dropped")
+		return
+	}
+	go func() {
+		defer func() { <-notifySlots }()
+		r.send(a)
+	}()
+}
+
+// send sends a via r, retrying with a backoff on failure
+func (r *receiver) send(a *msgFormat) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		err := r.n.notify(ctx, a)
+		cancel()
+		if err == nil {
+			notifications.inc("receiver", r.name, "result", "sent")
+			return
+		}
+
+		r.fl.Printf("attempt %d to send alert %s failed: %v\n", attempt+1, a.ID, err)
+		if attempt >= r.retries {
+			l.Printf("could not notify %s of alert %s: %v\n", r.name, a.ID, err)
+			notifications.inc("receiver", r.name, "result", "failed")
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// tmplFuncs are the functions available to templates in receiver configs
+var tmplFuncs = template.FuncMap{
+	// json encodes v as JSON, eg. to put a field in a JSON body: {"text": {{json .Short}}}
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parseTmpl parses text as a template, falling back to def if text is empty
+func parseTmpl(name, text, def string) (*template.Template, error) {
+	if text == "" {
+		text = def
+	}
+	return template.New(name).Funcs(tmplFuncs).Parse(text)
+}
+
+// execTmpl executes t with a
+func execTmpl(t *template.Template, a *msgFormat) ([]byte, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, a); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
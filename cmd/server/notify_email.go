@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultSubject = `[WD] {{.Severity}} {{.From}}/{{.TaskName}}: {{.Short}}`
+	defaultText    = `Time:     {{.Time}}
+ID:       {{.ID}}
+Host:     {{.From}}
+Task:     {{.TaskName}}
+Status:   {{.Status}}
+Severity: {{.Severity}}
+
+{{.Short}}
+
+{{.Long}}
+`
+)
+
+type emailCfg struct {
+	Addr     string   `json:"addr"` // SMTP server in the format host:port
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Subject  string   `json:"subject"` // template
+	Text     string   `json:"text"`    // template for body
+}
+
+// email sends alerts as mails via SMTP
+type email struct {
+	cfg     *emailCfg
+	auth    smtp.Auth
+	subject *template.Template
+	text    *template.Template
+}
+
+func newEmail(c *emailCfg) (*email, error) {
+	if c.Addr == "" || c.From == "" || len(c.To) == 0 {
+		return nil, errors.New("addr, from and to are required")
+	}
+	host, _, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid addr: %v", err)
+	}
+
+	e := &email{cfg: c}
+	if c.Username != "" {
+		e.auth = smtp.PlainAuth("", c.Username, c.Password, host)
+	}
+	if e.subject, err = parseTmpl("subject", c.Subject, defaultSubject); err != nil {
+		return nil, err
+	}
+	if e.text, err = parseTmpl("text", c.Text, defaultText); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *email) notify(ctx context.Context, a *msgFormat) error {
+	subject, err := execTmpl(e.subject, a)
+	if err != nil {
+		return err
+	}
+	text, err := execTmpl(e.text, a)
+	if err != nil {
+		return err
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	// newlines in subject would break the headers
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.Join(strings.Fields(string(subject)), " "))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(string(text), "\n", "\r\n"))
+
+	return sendMail(ctx, e.cfg.Addr, e.auth, e.cfg.From, e.cfg.To, []byte(msg.String()))
+}
+
+// sendMail is smtp.SendMail, but gives up once ctx is done: the connection
+// has the deadline of ctx, so nothing is left running after it returns.
+func sendMail(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStub is a minimal SMTP server that accepts one message per
+// connection. If stall is set, it greets and then never replies.
+type smtpStub struct {
+	ln    net.Listener
+	stall bool
+	msgs  chan string // data of the messages received
+	done  chan error  // error that ended each connection
+}
+
+func newSMTPStub(t *testing.T, stall bool) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{ln: ln, stall: stall, msgs: make(chan string, 10), done: make(chan error, 10)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { s.done <- s.serve(c) }()
+		}
+	}()
+	return s
+}
+
+func (s *smtpStub) serve(c net.Conn) error {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	reply := func(line string) { c.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP stub")
+	var data []string
+	inData := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if s.stall {
+			continue
+		}
+		if inData {
+			if line == "." {
+				inData = false
+				s.msgs <- strings.Join(data, "\n")
+				reply("250 OK")
+				continue
+			}
+			data = append(data, line)
+			continue
+		}
+		switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+		case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+			reply("250 OK")
+		case "DATA":
+			inData = true
+			reply("354 go ahead")
+		case "QUIT":
+			reply("221 bye")
+			return nil
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestEmailNotify(t *testing.T) {
+	s := newSMTPStub(t, false)
+	e, err := newEmail(&emailCfg{
+		Addr: s.ln.Addr().String(),
+		From: "wd@example.com",
+		To:   []string{"dba@example.com", "ops@example.com"},
+		Text: "{{.Long}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &msgFormat{ID: "a1", From: "db-1", TaskName: "disk", Severity: "CRITICAL", Short: "disk\nfull", Long: "93% used"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.notify(ctx, a); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+
+	msg := <-s.msgs
+	for _, want := range []string{
+		"From: wd@example.com",
+		"To: dba@example.com, ops@example.com",
+		"Subject: [WD] CRITICAL db-1/disk: disk full",
+		"93% used",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("mail does not have %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestEmailNotifyGivesUpWithContext(t *testing.T) {
+	s := newSMTPStub(t, true)
+	e, err := newEmail(&emailCfg{Addr: s.ln.Addr().String(), From: "wd@example.com", To: []string{"dba@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := e.notify(ctx, &msgFormat{ID: "a1"}); err == nil {
+		t.Fatal("notify succeeded with a server that does not reply")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("notify took %v with a 200ms timeout", d)
+	}
+
+	// the connection should be closed, so that the mail cannot be sent
+	// after notify has given up on it
+	select {
+	case <-s.done:
+	case <-time.After(2 * time.Second):
+		t.Error("connection to server is still open after notify returned")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSendAsyncLimit(t *testing.T) {
+	block := make(chan struct{})
+	n := &blockingNotifier{block: block}
+	r := &receiver{name: "test", n: n, fl: l}
+	for i := 0; i < maxPendingNotifications+10; i++ {
+		r.sendAsync(&msgFormat{ID: "a"})
+	}
+	if got := len(notifySlots); got != maxPendingNotifications {
+		t.Errorf("got %d notifications pending, want %d", got, maxPendingNotifications)
+	}
+	close(block)
+	for i := 0; len(notifySlots) > 0; i++ {
+		if i > 100 {
+			t.Fatal("slots not released after notifications were sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type blockingNotifier struct{ block chan struct{} }
+
+func (n *blockingNotifier) notify(ctx context.Context, a *msgFormat) error {
+	<-n.block
+	return nil
+}
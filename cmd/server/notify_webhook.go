@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+)
+
+const defaultChatText = `*{{.Severity}}* {{.From}}/{{.TaskName}}: {{.Short}}`
+
+var httpClient = &http.Client{}
+
+type webhookCfg struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// template for request body. If not given, the alert is sent as JSON
+	// in the same format as it's sent to websocket connections.
+	Body string `json:"body"`
+}
+
+// webhook posts alerts to a URL
+type webhook struct {
+	cfg  *webhookCfg
+	body *template.Template
+}
+
+func newWebhook(c *webhookCfg) (*webhook, error) {
+	if c.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	w := &webhook{cfg: c}
+	if c.Body != "" {
+		var err error
+		if w.body, err = parseTmpl("body", c.Body, ""); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *webhook) notify(ctx context.Context, a *msgFormat) error {
+	var (
+		b   []byte
+		err error
+	)
+	if w.body != nil {
+		b, err = execTmpl(w.body, a)
+	} else {
+		b, err = json.Marshal(a)
+	}
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.cfg.URL, w.cfg.Headers, b)
+}
+
+type chatCfg struct {
+	URL      string `json:"url"` // incoming webhook URL
+	Channel  string `json:"channel"`
+	Username string `json:"username"`
+	Text     string `json:"text"` // template
+}
+
+// chat posts alerts to Slack or Mattermost via an incoming webhook
+type chat struct {
+	cfg  *chatCfg
+	text *template.Template
+}
+
+func newChat(c *chatCfg) (*chat, error) {
+	if c.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	t, err := parseTmpl("text", c.Text, defaultChatText)
+	if err != nil {
+		return nil, err
+	}
+	return &chat{cfg: c, text: t}, nil
+}
+
+func (c *chat) notify(ctx context.Context, a *msgFormat) error {
+	text, err := execTmpl(c.text, a)
+	if err != nil {
+		return err
+	}
+	// both slack and mattermost accept this
+	b, err := json.Marshal(struct {
+		Text     string `json:"text"`
+		Channel  string `json:"channel,omitempty"`
+		Username string `json:"username,omitempty"`
+	}{string(text), c.cfg.Channel, c.cfg.Username})
+	if err != nil {
+		return err
+	}
+	return post(ctx, c.cfg.URL, nil, b)
+}
+
+// post posts body as JSON to url; any response other than 2xx is an error
+func post(ctx context.Context, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
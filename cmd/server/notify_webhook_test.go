@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request is a request received by a webhookStub
+type request struct {
+	header http.Header
+	body   string
+}
+
+// webhookStub starts a server that replies with status to every request
+// and records them
+func webhookStub(t *testing.T, status int) (*httptest.Server, chan request) {
+	t.Helper()
+	reqs := make(chan request, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		reqs <- request{r.Header, string(b)}
+		rw.WriteHeader(status)
+		io.WriteString(rw, "stub says hi")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, reqs
+}
+
+func testCtx(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+var testAlert = &msgFormat{ID: "a1", From: "db-1", TaskName: "disk", Severity: "CRITICAL", Short: `disk "full"`}
+
+func TestWebhookNotify(t *testing.T) {
+	srv, reqs := webhookStub(t, http.StatusOK)
+	w, err := newWebhook(&webhookCfg{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer xyz"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.notify(testCtx(t), testAlert); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+
+	r := <-reqs
+	if got := r.header.Get("Authorization"); got != "Bearer xyz" {
+		t.Errorf("got Authorization %q, want Bearer xyz", got)
+	}
+	if got := r.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q, want application/json", got)
+	}
+	var m msgFormat
+	if err := json.Unmarshal([]byte(r.body), &m); err != nil || m.ID != "a1" || m.From != "db-1" {
+		t.Errorf("got body %s (%v), want the alert as JSON", r.body, err)
+	}
+}
+
+func TestWebhookNotifyTemplate(t *testing.T) {
+	srv, reqs := webhookStub(t, http.StatusCreated)
+	w, err := newWebhook(&webhookCfg{URL: srv.URL, Body: `{"title": {{json .Short}}}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.notify(testCtx(t), testAlert); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if r := <-reqs; r.body != `{"title": "disk \"full\""}` {
+		t.Errorf("got body %s", r.body)
+	}
+}
+
+func TestWebhookNotifyError(t *testing.T) {
+	srv, _ := webhookStub(t, http.StatusBadGateway)
+	w, _ := newWebhook(&webhookCfg{URL: srv.URL})
+	err := w.notify(testCtx(t), testAlert)
+	if err == nil || !strings.Contains(err.Error(), "502") || !strings.Contains(err.Error(), "stub says hi") {
+		t.Errorf("got %v, want error with the status and body of the response", err)
+	}
+}
+
+func TestChatNotify(t *testing.T) {
+	srv, reqs := webhookStub(t, http.StatusOK)
+	c, err := newChat(&chatCfg{URL: srv.URL, Channel: "#ops", Username: "wd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.notify(testCtx(t), testAlert); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+
+	var got struct{ Text, Channel, Username string }
+	if err := json.Unmarshal([]byte((<-reqs).body), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := `*CRITICAL* db-1/disk: disk "full"`
+	if got.Text != want || got.Channel != "#ops" || got.Username != "wd" {
+		t.Errorf("got %+v, want text %q in #ops as wd", got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// replayAlerts returns the stored alerts that a newly connected ws client
+// asked for via query params of the connect request, oldest first:
+//
+//	last=N       - the last N alerts
+//	since=ID     - alerts received after the alert with that ID
+//	since=TIME   - alerts received after TIME (RFC 3339)
+//	               (the last maxPageSize of them, in both cases)
+//	open=true    - alerts that are still open
+//
+// If more than one is given, the alerts are combined without duplicates.
+// Only alerts of hosts that u can see, and that match filter if it's not
+// nil, are returned. If the alert in since=ID is not known (eg. it has
+// been pruned), the open alerts are returned instead and reset is true;
+// the client should then reload whatever it shows.
+func replayAlerts(q url.Values, u *user, filter *matcher) (alerts []*storedAlert, reset bool, err error) {
+	var sets [][]*storedAlert
+
+	if v := q.Get("last"); v != "" {
+		n, err := parseInt(v, 0)
+		if err != nil {
+			return nil, false, &apiError{http.StatusBadRequest, err.Error()}
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		alerts, _, err := db.list(&alertFilter{Allow: u.canSee, Match: filter}, 0, n)
+		if err != nil {
+			return nil, false, err
+		}
+		reverse(alerts)
+		sets = append(sets, alerts)
+	}
+
+	if v := q.Get("since"); v != "" {
+		var alerts []*storedAlert
+		f := &alertFilter{Allow: u.canSee, Match: filter}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			f.From = t.Add(time.Nanosecond)
+			alerts, _, err = db.list(f, 0, maxPageSize)
+			if err != nil {
+				return nil, false, err
+			}
+			reverse(alerts)
+		} else {
+			alerts, err = db.after(v, f, maxPageSize)
+			if err == errNotFound {
+				reset = true
+				alerts, err = db.open()
+			}
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		sets = append(sets, alerts)
+	}
+
+	if v := q.Get("open"); v != "" {
+		open, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, false, &apiError{http.StatusBadRequest, fmt.Sprintf("invalid value %q for open", v)}
+		}
+		if open {
+			alerts, err := db.open()
+			if err != nil {
+				return nil, false, err
+			}
+			sets = append(sets, alerts)
+		}
+	}
+
+	// silenced alerts were never sent; keep it that way
+	for _, a := range merge(sets...) {
+		if a.SilencedBy == "" && u.canSee(a.From) && (filter == nil || filter.match(&a.msgFormat)) {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts, reset, nil
+}
+
+// merge merges sets of alerts, each sorted oldest first, into one
+// sorted by the time of receipt without duplicates
+func merge(sets ...[]*storedAlert) []*storedAlert {
+	if len(sets) == 1 {
+		return sets[0]
+	}
+	seen := make(map[string]bool)
+	var all []*storedAlert
+	for _, set := range sets {
+		for _, a := range set {
+			if !seen[a.ID] {
+				seen[a.ID] = true
+				all = append(all, a)
+			}
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Received.Before(all[j].Received)
+	})
+	return all
+}
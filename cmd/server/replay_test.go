@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestReplaySinceIsCapped(t *testing.T) {
+	useStore(t)
+	start := time.Now()
+	n := maxPageSize + 5
+	for i := 0; i < n; i++ {
+		a := newStored(fmt.Sprint("a", i), "db-1", fmt.Sprint("task", i))
+		a.Received = start.Add(time.Duration(i) * time.Millisecond)
+		if _, _, err := db.add(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, since := range []string{"a0", start.Format(time.RFC3339Nano)} {
+		alerts, _, err := replayAlerts(url.Values{"since": {since}}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != maxPageSize {
+			t.Fatalf("since=%s: got %d alerts, want %d", since, len(alerts), maxPageSize)
+		}
+		// the latest ones, oldest first
+		if first, last := alerts[0].ID, alerts[len(alerts)-1].ID; first != "a5" || last != fmt.Sprint("a", n-1) {
+			t.Errorf("since=%s: got %s..%s, want a5..a%d", since, first, last, n-1)
+		}
+	}
+}
+
+func TestReplayFiltered(t *testing.T) {
+	useStore(t)
+	for i, host := range []string{"db-1", "web-1", "db-2"} {
+		if _, _, err := db.add(newStored(fmt.Sprint("a", i), host, "disk")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alerts, _, err := replayAlerts(url.Values{"since": {"a0"}, "last": {"2"}}, nil, &matcher{Host: "db-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, a := range alerts {
+		ids = append(ids, a.ID)
+	}
+	if fmt.Sprint(ids) != "[a0 a2]" {
+		t.Errorf("got %v, want [a0 a2]", ids)
+	}
+}
+
+func TestReplaySinceUnknownID(t *testing.T) {
+	useStore(t)
+	for _, a := range []*storedAlert{newStored("a0", "db-1", "disk"), newStored("a1", "db-1", "cpu")} {
+		if _, _, err := db.add(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.update("a0", func(a *storedAlert) error {
+		return resolve(a, "test", "", time.Now())
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// eg. pruned since the client last saw it; it gets the open alerts
+	alerts, reset, err := replayAlerts(url.Values{"since": {"gone"}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reset || len(alerts) != 1 || alerts[0].ID != "a1" {
+		t.Errorf("got %d alerts, reset %v; want a1 with reset", len(alerts), reset)
+	}
+}
+
+func TestReplayBadParams(t *testing.T) {
+	useStore(t)
+	for _, q := range []url.Values{{"last": {"x"}}, {"last": {"-1"}}, {"open": {"maybe"}}} {
+		_, _, err := replayAlerts(q, nil, nil)
+		if e, ok := err.(*apiError); !ok || e.code != http.StatusBadRequest {
+			t.Errorf("%v: got %v, want status 400", q, err)
+		}
+	}
+}
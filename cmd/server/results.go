@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+	bolt "go.etcd.io/bbolt"
+)
+
+var resultsBucket = []byte("results") // hostname + "\x00" + task -> taskStats
+
+// windows over which uptime of tasks is calculated. The longest one
+// decides how long the run counts are kept.
+var uptimeWindows = []struct {
+	name string
+	d    time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+}
+
+// taskStats is what's kept of the results of a task on a host
+type taskStats struct {
+	LastRun     *time.Time  `json:"lastRun,omitempty"`
+	LastSuccess *time.Time  `json:"lastSuccess,omitempty"`
+	LastResult  *taskResult `json:"lastResult,omitempty"`
+	// number of runs per hour, oldest first
+	Hours []hourStat `json:"hours"`
+}
+
+// taskResult is the outcome of a run of a task
+type taskResult struct {
+	ExitCode int32  `json:"exitCode"`
+	Severity string `json:"severity"`
+	Duration int64  `json:"durationMs"`
+}
+
+type hourStat struct {
+	Hour int64 `json:"hour"` // unix time of the start of the hour
+	Runs int   `json:"runs"`
+	OK   int   `json:"ok"` // runs that passed
+}
+
+// runStats is how the results of a task are sent out along with its host
+type runStats struct {
+	LastRun     *time.Time  `json:"lastRun,omitempty"`
+	LastSuccess *time.Time  `json:"lastSuccess,omitempty"`
+	LastResult  *taskResult `json:"lastResult,omitempty"`
+	// percentage of runs that passed, per uptime window. Missing if
+	// there were no runs in the window.
+	Uptime map[string]float64 `json:"uptime,omitempty"`
+}
+
+var (
+	statsMu sync.Mutex
+	stats   = map[string]*taskStats{} // hostname + "\x00" + task -> stats
+	// makes saves of stats happen in the order of the changes, without
+	// holding statsMu during the write
+	statsSaveMu sync.Mutex
+
+	// IDs of result batches received recently; batches are resent if
+	// the client could not confirm they were sent
+	seenResults = newRecentIDs(1000)
+)
+
+func statsKey(host, task string) string {
+	return host + "\x00" + task
+}
+
+// loadStats reads the stats of tasks saved in the store
+func loadStats() error {
+	return db.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).ForEach(func(k, v []byte) error {
+			st := &taskStats{}
+			if err := json.Unmarshal(v, st); err != nil {
+				return err
+			}
+			stats[string(k)] = st
+			return nil
+		})
+	})
+}
+
+func (pbSrv) SendResults(ctx context.Context, rs *proto.Results) (*proto.Void, error) {
+	if err := checkHostname(ctx, rs.Hostname); err != nil {
+		reject(ctx, "SendResults", rs.Hostname, err)
+		return nil, err
+	}
+	if seenResults.add(rs.Id) {
+		return &proto.Void{}, nil
+	}
+
+	// tasks whose last result went from passing to failing or back
+	flipped := false
+	changed := map[string][]byte{} // stats key -> stats to be saved
+
+	statsMu.Lock()
+	for _, r := range rs.Results {
+		k := statsKey(rs.Hostname, r.Task)
+		st, ok := stats[k]
+		if !ok {
+			st = &taskStats{}
+			stats[k] = st
+		}
+		wasOK := st.LastResult == nil || st.LastResult.ExitCode == 0
+		st.add(r)
+		recordMetrics(rs.Hostname, r.Task, r.Metrics)
+		if wasOK != (st.LastResult.ExitCode == 0) {
+			flipped = true
+		}
+		changed[k] = nil
+	}
+	for k := range changed {
+		v, err := json.Marshal(stats[k])
+		if err != nil {
+			l.Printf("could not save results of %s: %v\n", k, err)
+			delete(changed, k)
+			continue
+		}
+		changed[k] = v
+	}
+	// saved in the order of the changes, but without holding statsMu,
+	// which view needs while holding hostsMu
+	statsSaveMu.Lock()
+	statsMu.Unlock()
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(resultsBucket)
+		for k, v := range changed {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	statsSaveMu.Unlock()
+	if err != nil {
+		l.Printf("could not save results from %s: %v\n", rs.Hostname, err)
+	}
+
+	if flipped {
+		pushHost(rs.Hostname)
+	}
+	return &proto.Void{}, nil
+}
+
+// add adds the result r to st
+func (st *taskStats) add(r *proto.Result) {
+	at := time.Unix(0, r.Time*int64(time.Millisecond))
+	// results of a batch are in order, but a batch can be late
+	if st.LastRun == nil || !at.Before(*st.LastRun) {
+		st.LastRun = &at
+		st.LastResult = &taskResult{ExitCode: r.ExitCode, Severity: r.Severity.String(), Duration: r.Duration}
+	}
+	passed := r.ExitCode == 0
+	if passed && (st.LastSuccess == nil || at.After(*st.LastSuccess)) {
+		st.LastSuccess = &at
+	}
+
+	hour := at.Truncate(time.Hour).Unix()
+	i := len(st.Hours) - 1
+	for i >= 0 && st.Hours[i].Hour > hour {
+		i--
+	}
+	if i < 0 || st.Hours[i].Hour != hour {
+		// insert after i
+		st.Hours = append(st.Hours, hourStat{})
+		copy(st.Hours[i+2:], st.Hours[i+1:])
+		st.Hours[i+1] = hourStat{Hour: hour}
+		i++
+	}
+	st.Hours[i].Runs++
+	if passed {
+		st.Hours[i].OK++
+	}
+
+	// drop what's older than the longest window
+	oldest := time.Now().Add(-uptimeWindows[len(uptimeWindows)-1].d).Truncate(time.Hour).Unix()
+	n := 0
+	for n < len(st.Hours) && st.Hours[n].Hour < oldest {
+		n++
+	}
+	st.Hours = st.Hours[n:]
+}
+
+// runStatsOf returns the run stats of task on host at now, or nil if
+// no results were received for it
+func runStatsOf(host, task string, now time.Time) *runStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	st, ok := stats[statsKey(host, task)]
+	if !ok {
+		return nil
+	}
+
+	rs := &runStats{
+		LastRun:     st.LastRun,
+		LastSuccess: st.LastSuccess,
+		LastResult:  st.LastResult,
+	}
+	for _, w := range uptimeWindows {
+		since := now.Add(-w.d).Truncate(time.Hour).Unix()
+		var runs, ok int
+		for _, h := range st.Hours {
+			if h.Hour >= since {
+				runs += h.Runs
+				ok += h.OK
+			}
+		}
+		if runs == 0 {
+			continue
+		}
+		if rs.Uptime == nil {
+			rs.Uptime = map[string]float64{}
+		}
+		rs.Uptime[w.name] = float64(ok) * 100 / float64(runs)
+	}
+	return rs
+}
+
+// deleteStats removes the stats of all tasks of host
+func deleteStats(host string) error {
+	prefix := statsKey(host, "")
+	var keys []string
+	statsMu.Lock()
+	for k := range stats {
+		if strings.HasPrefix(k, prefix) {
+			delete(stats, k)
+			keys = append(keys, k)
+		}
+	}
+	statsSaveMu.Lock()
+	defer statsSaveMu.Unlock()
+	statsMu.Unlock()
+
+	return db.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(resultsBucket)
+		for _, k := range keys {
+			if err := b.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
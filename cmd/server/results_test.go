@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+)
+
+func TestSendResultsSaved(t *testing.T) {
+	useStore(t)
+	useHub(t)
+	old := stats
+	stats = map[string]*taskStats{}
+	seenResults = newRecentIDs(10)
+	t.Cleanup(func() { stats = old })
+
+	now := time.Now()
+	batch := &proto.Results{Id: "b1", Hostname: "db-1", Results: []*proto.Result{
+		{Task: "disk", Time: now.Add(-time.Minute).UnixNano() / int64(time.Millisecond)},
+		{Task: "disk", Time: now.UnixNano() / int64(time.Millisecond), ExitCode: 2, Severity: proto.Severity_CRITICAL},
+	}}
+	// resent batches are counted once
+	for i := 0; i < 2; i++ {
+		if _, err := (pbSrv{}).SendResults(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// what's kept in memory is what's saved
+	stats = map[string]*taskStats{}
+	if err := loadStats(); err != nil {
+		t.Fatal(err)
+	}
+	rs := runStatsOf("db-1", "disk", now)
+	if rs == nil {
+		t.Fatal("no stats saved")
+	}
+	if rs.LastResult.ExitCode != 2 || rs.Uptime["24h"] != 50 {
+		t.Errorf("got exit code %d, uptime %v; want 2, 50%%", rs.LastResult.ExitCode, rs.Uptime["24h"])
+	}
+
+	if err := deleteStats("db-1"); err != nil {
+		t.Fatal(err)
+	}
+	stats = map[string]*taskStats{}
+	if err := loadStats(); err != nil || len(stats) != 0 {
+		t.Errorf("after delete: got %d stats, %v; want none", len(stats), err)
+	}
+}
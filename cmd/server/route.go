@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opxyc/wd/proto"
+)
+
+// route decides which receivers are notified of alerts matching it
+type route struct {
+	Match     matcher  `json:"match"`
+	Receivers []string `json:"receivers"`
+	// whether to go on matching the routes after this one, if this one matched
+	Continue bool `json:"continue"`
+	// child routes; alerts matching this route are matched against them and
+	// this route's receivers are used only if none of them matched
+	Routes []*route `json:"routes"`
+}
+
+// routeMatch is a route that matched an alert
+type routeMatch struct {
+	path      string // position of route in the tree, eg. 1.2
+	r         *route
+	receivers []string
+}
+
+// routes from config. If empty, alerts are sent to all receivers.
+var routes []*route
+
+// validateRoutes checks the matchers in routes and that the receivers they refer to exist
+func validateRoutes(routes []*route, prefix string) error {
+	for i, r := range routes {
+		path := prefix + strconv.Itoa(i+1)
+		if err := r.Match.validate(); err != nil {
+			return fmt.Errorf("route %s: %v", path, err)
+		}
+		for _, name := range r.Receivers {
+			if _, ok := receivers[name]; !ok {
+				return fmt.Errorf("route %s: unknown receiver %q", path, name)
+			}
+		}
+		if err := validateRoutes(r.Routes, path+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// routeAlert returns the routes, in order, that a matched
+func routeAlert(routes []*route, a *msgFormat, prefix string) []routeMatch {
+	var matched []routeMatch
+	for i, r := range routes {
+		if !r.Match.match(a) {
+			continue
+		}
+		path := prefix + strconv.Itoa(i+1)
+		if sub := routeAlert(r.Routes, a, path+"."); len(sub) > 0 {
+			matched = append(matched, sub...)
+		} else {
+			matched = append(matched, routeMatch{path, r, r.Receivers})
+		}
+		if !r.Continue {
+			break
+		}
+	}
+	return matched
+}
+
+// receiversFor returns the names of receivers a is to be sent to
+func receiversFor(a *msgFormat) []string {
+	var names []string
+	if len(routes) == 0 {
+		for name := range receivers {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range routeAlert(routes, a, "") {
+		for _, name := range m.receivers {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// routeCmd implements the route subcommand, which shows the routes
+// a sample alert would take
+func routeCmd(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("route", flag.ContinueOnError)
+	cfgPath := fs.String("c", "", "path to config file")
+	host := fs.String("host", "", "hostname of the alert")
+	task := fs.String("task", "", "task name of the alert")
+	sev := fs.String("severity", proto.Severity_CRITICAL.String(), "severity of the alert")
+	status := fs.Int("status", int(proto.Status_FAILED), "status of the alert")
+	var labels labelFlag
+	fs.Var(&labels, "label", "label of the alert in the format key=value; can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := readConfig(*cfgPath)
+	if err != nil {
+		return err
+	}
+	for _, rc := range cfg.Receivers {
+		// only names are needed to validate routes
+		receivers[rc.Name] = &receiver{name: rc.Name}
+	}
+	if err := validateRoutes(cfg.Routes, ""); err != nil {
+		return err
+	}
+	routes = cfg.Routes
+
+	a := &msgFormat{From: *host, TaskName: *task, Severity: *sev, Status: int32(*status), Labels: labels}
+	if len(routes) == 0 {
+		fmt.Fprintln(w, "no routes configured; alert goes to all receivers")
+	}
+	for _, m := range routeAlert(routes, a, "") {
+		fmt.Fprintf(w, "route %-8s %-40s -> %v\n", m.path, m.r.Match.String(), m.receivers)
+	}
+	fmt.Fprintf(w, "receivers: %v\n", receiversFor(a))
+	return nil
+}
+
+// labelFlag collects key=value flags into a map
+type labelFlag map[string]string
+
+func (f *labelFlag) String() string {
+	return fmt.Sprint(map[string]string(*f))
+}
+
+func (f *labelFlag) Set(v string) error {
+	kv := strings.SplitN(v, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("expected key=value, got %q", v)
+	}
+	if *f == nil {
+		*f = make(map[string]string)
+	}
+	(*f)[kv[0]] = kv[1]
+	return nil
+}
+
+// runSubcommand runs the subcommand named in args[0], if any,
+// and reports whether it did
+func runSubcommand(args []string) bool {
+	if len(args) == 0 || args[0] != "route" {
+		return false
+	}
+	if err := routeCmd(args[1:], os.Stdout); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
+	}
+	return true
+}
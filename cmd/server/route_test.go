@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opxyc/wd/proto"
+)
+
+// readmeRouting returns the routing example config and the sample route
+// command with its output from the README
+func readmeRouting(t *testing.T) (cfg string, args []string, out string) {
+	b, err := ioutil.ReadFile("../../README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(b)
+	i := strings.Index(s, "#### Routing")
+	if i < 0 {
+		t.Fatal("no routing section in README")
+	}
+	s = s[i:]
+	block := func(fence string) string {
+		i := strings.Index(s, fence)
+		if i < 0 {
+			t.Fatalf("no %s block in README routing section", fence)
+		}
+		s = s[i+len(fence):]
+		j := strings.Index(s, "\n```")
+		b := s[:j]
+		s = s[j+4:]
+		return b
+	}
+
+	var lines []string
+	for _, line := range strings.Split(block("```js\n"), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "//") {
+			continue
+		}
+		lines = append(lines, strings.Replace(line, `"receivers": [...]`, `"receivers": [{"name": "ops-chat"}, {"name": "dba-mail"}]`, 1))
+	}
+	cmd := strings.SplitN(block("```\n"), "\n", 2)
+	if !strings.HasPrefix(cmd[0], "$ server route ") {
+		t.Fatalf("unexpected command in README: %s", cmd[0])
+	}
+	return strings.Join(lines, "\n"), strings.Fields(strings.TrimPrefix(cmd[0], "$ server route ")), cmd[1] + "\n"
+}
+
+func TestRouteAlert(t *testing.T) {
+	cfg, _, _ := readmeRouting(t)
+	var c config
+	if err := json.Unmarshal([]byte(cfg), &c); err != nil {
+		t.Fatal(err)
+	}
+	tree := c.Routes
+	// without the catch-all route at the end
+	noDefault := tree[:len(tree)-1]
+
+	critical, warning := proto.Severity_CRITICAL.String(), proto.Severity_WARNING.String()
+	failed := int32(proto.Status_FAILED)
+	tests := []struct {
+		name      string
+		routes    []*route
+		a         *msgFormat
+		paths     []string
+		receivers []string
+	}{
+		{
+			name:   "first match wins",
+			routes: tree,
+			a:      &msgFormat{From: "web-1", Severity: critical, Status: 0},
+			paths:  []string{"1"},
+		},
+		{
+			name:      "continue",
+			routes:    tree,
+			a:         &msgFormat{From: "web-1", Severity: critical, Status: failed},
+			paths:     []string{"2", "4"},
+			receivers: []string{"ops-chat", "dba-mail"},
+		},
+		{
+			name:      "continue into child route",
+			routes:    tree,
+			a:         &msgFormat{From: "db-1", Severity: critical, Status: failed, Labels: map[string]string{"env": "prod"}},
+			paths:     []string{"2", "3.1"},
+			receivers: []string{"ops-chat", "dba-mail"},
+		},
+		{
+			name:      "no child matched",
+			routes:    tree,
+			a:         &msgFormat{From: "db-1", Severity: warning, Status: failed, Labels: map[string]string{"env": "dev"}},
+			paths:     []string{"3"},
+			receivers: []string{"dba-mail"},
+		},
+		{
+			name:      "child overrides parent",
+			routes:    tree,
+			a:         &msgFormat{From: "db-1", Severity: warning, Status: failed, Labels: map[string]string{"env": "prod"}},
+			paths:     []string{"3.1"},
+			receivers: []string{"dba-mail", "ops-chat"},
+		},
+		{
+			name:   "matches nothing",
+			routes: noDefault,
+			a:      &msgFormat{From: "web-1", Severity: warning, Status: failed},
+		},
+	}
+
+	oldRoutes, oldReceivers := routes, receivers
+	defer func() { routes, receivers = oldRoutes, oldReceivers }()
+	receivers = map[string]*receiver{"ops-chat": {name: "ops-chat"}, "dba-mail": {name: "dba-mail"}}
+	for _, tt := range tests {
+		var paths []string
+		for _, m := range routeAlert(tt.routes, tt.a, "") {
+			paths = append(paths, m.path)
+		}
+		if !reflect.DeepEqual(paths, tt.paths) {
+			t.Errorf("%s: got routes %v, want %v", tt.name, paths, tt.paths)
+		}
+		routes = tt.routes
+		if got := receiversFor(tt.a); !reflect.DeepEqual(got, tt.receivers) {
+			t.Errorf("%s: got receivers %v, want %v", tt.name, got, tt.receivers)
+		}
+	}
+}
+
+func TestRouteCmdREADME(t *testing.T) {
+	oldRoutes, oldReceivers := routes, receivers
+	defer func() { routes, receivers = oldRoutes, oldReceivers }()
+	receivers = map[string]*receiver{}
+
+	cfg, args, want := readmeRouting(t)
+	p := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(p, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i, arg := range args {
+		if arg == "config.json" {
+			args[i] = p
+		}
+	}
+
+	var out bytes.Buffer
+	if err := routeCmd(args, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant (from README):\n%s", out.String(), want)
+	}
+}
+
+func TestRouteCmdUnknownReceiver(t *testing.T) {
+	oldRoutes, oldReceivers := routes, receivers
+	defer func() { routes, receivers = oldRoutes, oldReceivers }()
+	receivers = map[string]*receiver{}
+
+	p := filepath.Join(t.TempDir(), "config.json")
+	cfg := `{"receivers": [{"name": "ops-chat"}], "routes": [{"routes": [{"receivers": ["nobody"]}]}]}`
+	if err := ioutil.WriteFile(p, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := routeCmd([]string{"-c", p}, ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "route 1.1") {
+		t.Errorf("got %v, want an error about route 1.1", err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lithammer/shortuuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+var silencesBucket = []byte("silences") // silence ID -> silence
+
+// silence stops alerts matching it from being broadcast between StartsAt
+// and EndsAt. Silenced alerts are still stored.
+type silence struct {
+	ID string `json:"id"`
+	matcher
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// active reports whether s is in effect at t
+func (s *silence) active(t time.Time) bool {
+	return !t.Before(s.StartsAt) && t.Before(s.EndsAt)
+}
+
+// putSilence adds or replaces s in the store
+func (s *store) putSilence(sl *silence) error {
+	b, err := json.Marshal(sl)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(silencesBucket).Put([]byte(sl.ID), b)
+	})
+}
+
+// silences returns all silences in the store
+func (s *store) silences() ([]*silence, error) {
+	var silences []*silence
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(silencesBucket).ForEach(func(_, v []byte) error {
+			sl := &silence{}
+			if err := json.Unmarshal(v, sl); err != nil {
+				return err
+			}
+			silences = append(silences, sl)
+			return nil
+		})
+	})
+	return silences, err
+}
+
+// silencedBy returns the ID of an active silence matching a, or empty string if none
+func silencedBy(a *msgFormat, t time.Time) string {
+	silences, err := db.silences()
+	if err != nil {
+		l.Printf("could not look up silences: %v\n", err)
+		return ""
+	}
+	for _, s := range silences {
+		if s.active(t) && s.match(a) {
+			return s.ID
+		}
+	}
+	return ""
+}
+
+// silencesHandler handles:
+//
+//	GET    /silences[?active=true]
+//	POST   /silences       {"host": "db-*", "task": "", "labels": {}, "startsAt": "", "endsAt": "", "createdBy": "", "comment": ""}
+//	DELETE /silences/{id}  - expires the silence
+//
+// Users see and manage only the silences whose host covers no more than
+// the hosts they can see (see user.covers).
+func silencesHandler(r *http.Request) (interface{}, error) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/silences"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		return listSilences(r)
+	case id == "" && r.Method == http.MethodPost:
+		return createSilence(r)
+	case id != "" && r.Method == http.MethodDelete:
+		return expireSilence(id, userFrom(r))
+	}
+	return nil, errMethod(r.Method)
+}
+
+func listSilences(r *http.Request) (interface{}, error) {
+	activeOnly, _ := strconv.ParseBool(r.URL.Query().Get("active"))
+	silences, err := db.silences()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	u := userFrom(r)
+	list := []*silence{}
+	for _, s := range silences {
+		if u.covers(s.Host) && (!activeOnly || s.active(now)) {
+			list = append(list, s)
+		}
+	}
+	return list, nil
+}
+
+func createSilence(r *http.Request) (interface{}, error) {
+	s := &silence{}
+	if err := json.NewDecoder(r.Body).Decode(s); err != nil {
+		return nil, fmt.Errorf("invalid body: %v", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	if u := userFrom(r); u != nil {
+		if !u.covers(s.Host) {
+			return nil, &apiError{http.StatusForbidden, fmt.Sprintf("cannot silence host %q", s.Host)}
+		}
+		// it's whoever is logged in
+		s.CreatedBy = u.Name
+	}
+	now := time.Now()
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	switch {
+	case s.CreatedBy == "":
+		return nil, errors.New("createdBy is required")
+	case s.EndsAt.IsZero():
+		return nil, errors.New("endsAt is required")
+	case !s.EndsAt.After(s.StartsAt):
+		return nil, errors.New("endsAt should be after startsAt")
+	}
+	s.ID = shortuuid.New()
+	s.CreatedAt = now
+
+	if err := db.putSilence(s); err != nil {
+		return nil, err
+	}
+	l.Printf("silence %s created by %s: host=%q task=%q labels=%v from %v to %v\n",
+		s.ID, s.CreatedBy, s.Host, s.Task, s.Labels, s.StartsAt, s.EndsAt)
+	return s, nil
+}
+
+func expireSilence(id string, u *user) (interface{}, error) {
+	silences, err := db.silences()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range silences {
+		if s.ID != id || !u.covers(s.Host) {
+			continue
+		}
+		now := time.Now()
+		if s.EndsAt.After(now) {
+			s.EndsAt = now
+			if err := db.putSilence(s); err != nil {
+				return nil, err
+			}
+			l.Printf("silence %s expired\n", s.ID)
+		}
+		return s, nil
+	}
+	return nil, &apiError{http.StatusNotFound, fmt.Sprintf("silence %s not found", id)}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postSilence(u *user, body string) (interface{}, error) {
+	r := httptest.NewRequest(http.MethodPost, "/silences", strings.NewReader(body))
+	return silencesHandler(asUser(r, u))
+}
+
+func TestSilencesRestrictedToUserHosts(t *testing.T) {
+	useStore(t)
+	dba := newUser("dba", scopeAdmin, "db-*")
+	root := newUser("root", scopeAdmin, "*")
+	useUsers(t, dba, root)
+
+	end := time.Now().Add(time.Hour).Format(time.RFC3339)
+	for _, host := range []string{"", "*", "web-1"} {
+		_, err := postSilence(dba, `{"host": "`+host+`", "endsAt": "`+end+`"}`)
+		if e, ok := err.(*apiError); !ok || e.code != http.StatusForbidden {
+			t.Errorf("silence of host %q by dba: got %v, want 403", host, err)
+		}
+	}
+
+	v, err := postSilence(dba, `{"host": "db-*", "endsAt": "`+end+`", "createdBy": "someone else"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := v.(*silence); s.CreatedBy != "dba" {
+		t.Errorf("got createdBy %q, want the logged in user", s.CreatedBy)
+	}
+	if _, err := postSilence(root, `{"host": "", "endsAt": "`+end+`"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(u *user) []*silence {
+		v, err := silencesHandler(asUser(httptest.NewRequest(http.MethodGet, "/silences", nil), u))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.([]*silence)
+	}
+	if got := list(dba); len(got) != 1 || got[0].Host != "db-*" {
+		t.Errorf("dba sees %d silences, want only the one of db-*", len(got))
+	}
+	all := list(root)
+	if len(all) != 2 {
+		t.Errorf("root sees %d silences, want 2", len(all))
+	}
+
+	// dba cannot expire the silence of all hosts
+	for _, s := range all {
+		r := httptest.NewRequest(http.MethodDelete, "/silences/"+s.ID, nil)
+		_, err := silencesHandler(asUser(r, dba))
+		if (s.Host == "") != (err != nil) {
+			t.Errorf("expiring silence of host %q by dba: got %v", s.Host, err)
+		}
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	alertsBucket = []byte("alerts") // seq -> storedAlert
+	idsBucket    = []byte("ids")    // alert ID -> seq
+	openBucket   = []byte("open")   // alert ID -> seq, of alerts that are not resolved
+	fpBucket     = []byte("fps")    // fingerprint (see fpKey) -> seq, of alerts that are not resolved
+	// host \x00 task \x00 alert ID -> nothing, of alerts that are not resolved
+	openTasksBucket = []byte("openTasks")
+
+	errNotFound = errors.New("not found")
+)
+
+// store persists alerts received by the server
+type store struct {
+	db *bolt.DB
+}
+
+// storedAlert is an alert as kept in the store
+type storedAlert struct {
+	msgFormat
+	Received time.Time `json:"received"` // time at which server received the alert
+}
+
+// openStore opens (creating if required) the store at path
+func openStore(path string) (*store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{alertsBucket, idsBucket, openBucket, fpBucket, silencesBucket, hostsBucket, resultsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(openTasksBucket) == nil {
+			return indexOpenTasks(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &store{db: db}, nil
+}
+
+// Close closes the underlying db
+func (s *store) Close() error {
+	return s.db.Close()
+}
+
+// addResult tells what store.add did with an alert
+type addResult int
+
+const (
+	addedNew       addResult = iota // stored as a new alert
+	addedMerged                     // merged into an open alert
+	addedDuplicate                  // already had it; nothing changed
+)
+
+// add adds a to the store. Alerts are kept in the order in which they were added.
+// If a is open and an alert with the same fingerprint is not resolved yet, a is
+// merged into it instead: its count is incremented and it takes the message,
+// severity and metrics of a. Alerts are not merged if only one of them is silenced.
+// The alert that a ended up in is returned. If an alert with the ID of a was
+// added earlier (eg. resent by a client that could not confirm it was
+// received), the store is left as it is and res is addedDuplicate.
+func (s *store) add(a *storedAlert) (stored *storedAlert, res addResult, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		alerts, ids := tx.Bucket(alertsBucket), tx.Bucket(idsBucket)
+		if k := ids.Get([]byte(a.ID)); k != nil {
+			res = addedDuplicate
+			stored = &storedAlert{}
+			return json.Unmarshal(alerts.Get(k), stored)
+		}
+		merged := false
+
+		var k []byte
+		if a.State == stateOpen {
+			k = tx.Bucket(fpBucket).Get(fpKey(a))
+		}
+		if k != nil {
+			stored = &storedAlert{}
+			if err := json.Unmarshal(alerts.Get(k), stored); err != nil {
+				return err
+			}
+			// silenced alerts have an entry of their own (see fpKey), but
+			// stores written before that can still mix them up
+			if (stored.SilencedBy == "") == (a.SilencedBy == "") {
+				stored.Count++
+				stored.LastSeen = &a.Received
+				stored.Time, stored.Short, stored.Long, stored.Severity = a.Time, a.Short, a.Long, a.Severity
+				stored.Metrics = a.Metrics
+				merged = true
+			} else {
+				k = nil
+			}
+		}
+		if !merged {
+			seq, err := alerts.NextSequence()
+			if err != nil {
+				return err
+			}
+			k = itob(seq)
+			stored = a
+		}
+
+		b, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		if err := alerts.Put(k, b); err != nil {
+			return err
+		}
+		// a's ID refers to the alert it is merged into, so that it can
+		// be looked up and a duplicate of it is recognised
+		if err := ids.Put([]byte(a.ID), k); err != nil {
+			return err
+		}
+		if merged {
+			res = addedMerged
+		}
+		return setOpen(tx, stored, k)
+	})
+	return stored, res, err
+}
+
+// update applies f to the alert with given id and saves it.
+// If f returns an error, the alert is left as it is.
+func (s *store) update(id string, f func(a *storedAlert) error) (*storedAlert, error) {
+	var a *storedAlert
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		alerts := tx.Bucket(alertsBucket)
+		k := tx.Bucket(idsBucket).Get([]byte(id))
+		if k == nil {
+			return errNotFound
+		}
+		a = &storedAlert{}
+		if err := json.Unmarshal(alerts.Get(k), a); err != nil {
+			return err
+		}
+		if err := f(a); err != nil {
+			return err
+		}
+		b, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		if err := alerts.Put(k, b); err != nil {
+			return err
+		}
+		return setOpen(tx, a, k)
+	})
+	return a, err
+}
+
+// setOpen adds or removes the alert a, stored with key k, from the
+// open, fingerprint and task indexes
+func setOpen(tx *bolt.Tx, a *storedAlert, k []byte) error {
+	open, fps, tasks := tx.Bucket(openBucket), tx.Bucket(fpBucket), tx.Bucket(openTasksBucket)
+	if a.State == stateOpen || a.State == stateAcked {
+		if err := fps.Put(fpKey(a), k); err != nil {
+			return err
+		}
+		if err := tasks.Put(openTaskKey(a), nil); err != nil {
+			return err
+		}
+		return open.Put([]byte(a.ID), k)
+	}
+	if bytes.Equal(fps.Get(fpKey(a)), k) {
+		if err := fps.Delete(fpKey(a)); err != nil {
+			return err
+		}
+	}
+	if err := tasks.Delete(openTaskKey(a)); err != nil {
+		return err
+	}
+	return open.Delete([]byte(a.ID))
+}
+
+// fpKey is the key of a in the fingerprint index. Silenced alerts are
+// kept apart, so that an open alert and a silenced one with the same
+// fingerprint do not replace each other in it.
+func fpKey(a *storedAlert) []byte {
+	if a.SilencedBy != "" {
+		return []byte(a.Fingerprint + "\x00silenced")
+	}
+	return []byte(a.Fingerprint)
+}
+
+func openTaskKey(a *storedAlert) []byte {
+	return []byte(a.From + "\x00" + a.TaskName + "\x00" + a.ID)
+}
+
+// indexOpenTasks creates the task index of open alerts in a store
+// created before it was added
+func indexOpenTasks(tx *bolt.Tx) error {
+	tasks, err := tx.CreateBucket(openTasksBucket)
+	if err != nil {
+		return err
+	}
+	alerts := tx.Bucket(alertsBucket)
+	return tx.Bucket(openBucket).ForEach(func(_, k []byte) error {
+		a := &storedAlert{}
+		if err := json.Unmarshal(alerts.Get(k), a); err != nil {
+			return err
+		}
+		return tasks.Put(openTaskKey(a), nil)
+	})
+}
+
+// openTasks returns the number of open alerts of each task of host. Unlike
+// open, it reads only the index, so it's cheap enough to call for each alert.
+func (s *store) openTasks(host string) (map[string]int, error) {
+	count := map[string]int{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte(host + "\x00")
+		c := tx.Bucket(openTasksBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			rest := k[len(prefix):]
+			if i := bytes.LastIndexByte(rest, 0); i >= 0 {
+				count[string(rest[:i])]++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// get returns the alert with given id
+func (s *store) get(id string) (*storedAlert, error) {
+	var a *storedAlert
+	err := s.db.View(func(tx *bolt.Tx) error {
+		k := tx.Bucket(idsBucket).Get([]byte(id))
+		if k == nil {
+			return errNotFound
+		}
+		a = &storedAlert{}
+		return json.Unmarshal(tx.Bucket(alertsBucket).Get(k), a)
+	})
+	return a, err
+}
+
+// alertFilter decides which alerts are returned by list.
+// Zero valued fields match everything.
+type alertFilter struct {
+	Host     string
+	Task     string
+	Status   *int32
+	Severity string
+	From, To time.Time // range of received time
+	// hosts whose alerts can be returned; all if nil
+	Allow func(host string) bool
+	// if not nil, only alerts matching it are returned
+	Match *matcher
+}
+
+// alertHead is the part of a stored alert that alertFilter looks at
+// first; decoding it is cheaper than decoding the whole alert
+type alertHead struct {
+	From     string    `json:"from"`
+	TaskName string    `json:"taskName"`
+	Status   int32     `json:"status"`
+	Severity string    `json:"severity"`
+	Received time.Time `json:"received"`
+}
+
+func (f *alertFilter) match(a *storedAlert) bool {
+	h := &alertHead{From: a.From, TaskName: a.TaskName, Status: a.Status, Severity: a.Severity, Received: a.Received}
+	return f.matchHead(h) && (f.Match == nil || f.Match.match(&a.msgFormat))
+}
+
+// matchHead reports whether h matches f, leaving out f.Match
+func (f *alertFilter) matchHead(h *alertHead) bool {
+	switch {
+	case f.Host != "" && f.Host != h.From:
+		return false
+	case f.Task != "" && f.Task != h.TaskName:
+		return false
+	case f.Status != nil && *f.Status != h.Status:
+		return false
+	case f.Severity != "" && f.Severity != h.Severity:
+		return false
+	case !f.From.IsZero() && h.Received.Before(f.From):
+		return false
+	case !f.To.IsZero() && h.Received.After(f.To):
+		return false
+	case f.Allow != nil && !f.Allow(h.From):
+		return false
+	}
+	return true
+}
+
+// list returns alerts matching f, newest first, skipping the first offset
+// of them and returning at most limit. total is the number of alerts that matched f.
+func (s *store) list(f *alertFilter, offset, limit int) (alerts []*storedAlert, total int, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(alertsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			h := &alertHead{}
+			if err := json.Unmarshal(v, h); err != nil {
+				return err
+			}
+			// alerts are kept in the order in which they were
+			// received, so the rest are too old as well
+			if !f.From.IsZero() && h.Received.Before(f.From) {
+				break
+			}
+			if !f.matchHead(h) {
+				continue
+			}
+			// the whole alert is decoded only if it's needed
+			page := total >= offset && len(alerts) < limit
+			if f.Match != nil || page {
+				a := &storedAlert{}
+				if err := json.Unmarshal(v, a); err != nil {
+					return err
+				}
+				if f.Match != nil && !f.Match.match(&a.msgFormat) {
+					continue
+				}
+				if page {
+					alerts = append(alerts, a)
+				}
+			}
+			total++
+		}
+		return nil
+	})
+	return alerts, total, err
+}
+
+// after returns the last limit alerts matching f that were added after
+// the alert with given id, oldest first
+func (s *store) after(id string, f *alertFilter, limit int) ([]*storedAlert, error) {
+	var alerts []*storedAlert
+	err := s.db.View(func(tx *bolt.Tx) error {
+		from := tx.Bucket(idsBucket).Get([]byte(id))
+		if from == nil {
+			return errNotFound
+		}
+		c := tx.Bucket(alertsBucket).Cursor()
+		for k, v := c.Last(); k != nil && bytes.Compare(k, from) > 0 && len(alerts) < limit; k, v = c.Prev() {
+			a := &storedAlert{}
+			if err := json.Unmarshal(v, a); err != nil {
+				return err
+			}
+			if f.match(a) {
+				alerts = append(alerts, a)
+			}
+		}
+		return nil
+	})
+	reverse(alerts)
+	return alerts, err
+}
+
+// prune deletes alerts that were resolved before t, returning the number
+// of alerts deleted. Open and acknowledged alerts are kept however old they are.
+func (s *store) prune(t time.Time) (n int, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		alerts := tx.Bucket(alertsBucket)
+		var keys [][]byte
+		deleted := map[string]bool{}
+		c := alerts.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			a := &storedAlert{}
+			if err := json.Unmarshal(v, a); err != nil {
+				return err
+			}
+			// alerts are kept in the order in which they were received,
+			// and none of the rest could have been resolved before t
+			if !a.Received.Before(t) {
+				break
+			}
+			if a.State == stateResolved && a.ResolvedAt != nil && a.ResolvedAt.Before(t) {
+				keys = append(keys, append([]byte(nil), k...))
+				deleted[string(k)] = true
+			}
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		for _, k := range keys {
+			if err := alerts.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		// IDs of the deleted alerts and of those merged into them
+		ids := tx.Bucket(idsBucket)
+		var stale [][]byte
+		err := ids.ForEach(func(id, k []byte) error {
+			if deleted[string(k)] {
+				stale = append(stale, append([]byte(nil), id...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range stale {
+			if err := ids.Delete(id); err != nil {
+				return err
+			}
+		}
+		n = len(keys)
+		return nil
+	})
+	return n, err
+}
+
+// pruneInterval is how often alerts past their retention are deleted
+const pruneInterval = time.Hour
+
+// pruneAlerts deletes alerts resolved longer than retention ago, right
+// away and then every pruneInterval until ctx is done
+func pruneAlerts(ctx context.Context, retention time.Duration) {
+	t := time.NewTicker(pruneInterval)
+	defer t.Stop()
+	for now := time.Now(); ; {
+		if n, err := db.prune(now.Add(-retention)); err != nil {
+			l.Printf("could not delete old alerts: %v\n", err)
+		} else if n > 0 {
+			l.Printf("deleted %d alerts resolved more than %v ago\n", n, retention)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-t.C:
+		}
+	}
+}
+
+// open returns alerts that are not resolved yet, oldest first
+func (s *store) open() ([]*storedAlert, error) {
+	var alerts []*storedAlert
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var keys [][]byte
+		err := tx.Bucket(openBucket).ForEach(func(_, k []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i], keys[j]) < 0
+		})
+
+		b := tx.Bucket(alertsBucket)
+		for _, k := range keys {
+			a := &storedAlert{}
+			if err := json.Unmarshal(b.Get(k), a); err != nil {
+				return err
+			}
+			alerts = append(alerts, a)
+		}
+		return nil
+	})
+	return alerts, err
+}
+
+// reverse reverses alerts in place
+func reverse(alerts []*storedAlert) {
+	for i, j := 0, len(alerts)-1; i < j; i, j = i+1, j-1 {
+		alerts[i], alerts[j] = alerts[j], alerts[i]
+	}
+}
+
+// itob returns an 8-byte big endian representation of v
+// so that keys sort in numeric order
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
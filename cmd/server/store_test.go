@@ -0,0 +1,188 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func newStored(id, host, task string) *storedAlert {
+	a := &storedAlert{
+		msgFormat: msgFormat{ID: id, From: host, TaskName: task, Status: 1, Severity: "CRITICAL"},
+		Received:  time.Now(),
+	}
+	a.Fingerprint = fingerprint(host, task, nil)
+	initState(a)
+	a.Count, a.LastSeen = 1, &a.Received
+	return a
+}
+
+func TestStoreAdd(t *testing.T) {
+	useStore(t)
+
+	_, res, err := db.add(newStored("a1", "db-1", "disk"))
+	if err != nil || res != addedNew {
+		t.Fatalf("first alert: got %v, %v; want addedNew", res, err)
+	}
+	stored, res, err := db.add(newStored("a2", "db-1", "disk"))
+	if err != nil || res != addedMerged || stored.ID != "a1" || stored.Count != 2 {
+		t.Fatalf("repeat: got %v into %s (count %d), %v; want merged into a1 (count 2)", res, stored.ID, stored.Count, err)
+	}
+
+	for _, id := range []string{"a1", "a2"} {
+		stored, res, err = db.add(newStored(id, "db-1", "disk"))
+		if err != nil || res != addedDuplicate {
+			t.Fatalf("resent %s: got %v, %v; want addedDuplicate", id, res, err)
+		}
+		if stored.ID != "a1" || stored.Count != 2 {
+			t.Errorf("resent %s: got %s (count %d), want a1 unchanged (count 2)", id, stored.ID, stored.Count)
+		}
+	}
+
+	// a silenced alert is kept apart from the open one, and neither
+	// takes the place of the other
+	silenced := func(id string) *storedAlert {
+		a := newStored(id, "db-1", "disk")
+		a.SilencedBy = "s1"
+		return a
+	}
+	for _, c := range []struct {
+		a    *storedAlert
+		res  addResult
+		into string
+	}{
+		{silenced("a3"), addedNew, "a3"},
+		{newStored("a4", "db-1", "disk"), addedMerged, "a1"},
+		{silenced("a5"), addedMerged, "a3"},
+	} {
+		stored, res, err := db.add(c.a)
+		if err != nil || res != c.res || stored.ID != c.into {
+			t.Errorf("%s: got %v into %s, %v; want %v into %s", c.a.ID, res, stored.ID, err, c.res, c.into)
+		}
+	}
+	open, err := db.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 2 || open[0].ID != "a1" || open[1].ID != "a3" {
+		t.Errorf("got %d open alerts, want a1 and a3", len(open))
+	}
+}
+
+func TestStoreOpenTasks(t *testing.T) {
+	useStore(t)
+
+	for _, a := range []*storedAlert{
+		newStored("a1", "db-1", "disk"),
+		newStored("a2", "db-1", "mem"),
+		newStored("a3", "db-10", "disk"),
+	} {
+		if _, _, err := db.add(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	silenced := newStored("a4", "db-1", "disk")
+	silenced.SilencedBy = "s1"
+	if _, _, err := db.add(silenced); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.update("a2", func(a *storedAlert) error {
+		return resolve(a, "test", "", time.Now())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		t.Helper()
+		got, err := db.openTasks("db-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got["disk"] != 2 {
+			t.Errorf("got %v, want map[disk:2]", got)
+		}
+	}
+	check()
+
+	// stores created before the index are indexed when opened
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(openTasksBucket)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := db.db.Path()
+	db.Close()
+	if db, err = openStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check()
+}
+
+func TestStoreListFrom(t *testing.T) {
+	useStore(t)
+
+	start := time.Now().Add(-time.Hour)
+	for i, id := range []string{"a1", "a2", "a3", "a4"} {
+		a := newStored(id, "db-1", id)
+		a.Received = start.Add(time.Duration(i) * time.Minute)
+		if _, _, err := db.add(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := &alertFilter{From: start.Add(30 * time.Second), Match: &matcher{Task: "a[1-3]"}}
+	alerts, total, err := db.list(f, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(alerts) != 1 || alerts[0].ID != "a3" {
+		t.Errorf("got %d alerts (total %d), want a3 (total 2)", len(alerts), total)
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	useStore(t)
+
+	old := time.Now().Add(-48 * time.Hour)
+	add := func(id, task string, received time.Time, resolved bool) {
+		t.Helper()
+		a := newStored(id, "db-1", task)
+		a.Received = received
+		if _, _, err := db.add(a); err != nil {
+			t.Fatal(err)
+		}
+		if resolved {
+			_, err := db.update(id, func(a *storedAlert) error {
+				return resolve(a, "test", "", received)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	add("resolved", "disk", old, true)
+	add("open", "mem", old, false)
+	add("recent", "cpu", time.Now(), true)
+	// merged into the resolved alert before it was resolved
+	if _, err := db.update("resolved", func(a *storedAlert) error {
+		a.State = stateOpen
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	add("merged", "disk", old, true)
+
+	n, err := db.prune(time.Now().Add(-24 * time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("got %d, %v; want 1 deleted", n, err)
+	}
+	for id, want := range map[string]error{"resolved": errNotFound, "merged": errNotFound, "open": nil, "recent": nil} {
+		if _, err := db.get(id); err != want {
+			t.Errorf("%s: got %v, want %v", id, err, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// parseMatcher returns the filter given via query params of a connect
+// request, or nil if none was given:
+//
+//	host=GLOB, task=GLOB - host and task that raised the alert
+//	severity=S1,S2       - any of the severities
+//	status=N1,N2         - any of the statuses, by number or name
+//	label=KEY=VALUE      - labels the alert should have; can be repeated
+func parseMatcher(q url.Values) (*matcher, error) {
+	m := &matcher{Host: q.Get("host"), Task: q.Get("task")}
+	given := m.Host != "" || m.Task != ""
+
+	for _, s := range splitParam(q["severity"]) {
+		m.Severity = append(m.Severity, s)
+		given = true
+	}
+	for _, v := range splitParam(q["status"]) {
+		n, err := parseStatus(v)
+		if err != nil {
+			return nil, err
+		}
+		m.Status = append(m.Status, n)
+		given = true
+	}
+	for _, v := range q["label"] {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid label %q; should be key=value", v)
+		}
+		if m.Labels == nil {
+			m.Labels = make(map[string]string)
+		}
+		m.Labels[kv[0]] = kv[1]
+		given = true
+	}
+
+	if !given {
+		return nil, nil
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// splitParam splits comma separated values of a repeatable query param
+func splitParam(values []string) []string {
+	var all []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				all = append(all, s)
+			}
+		}
+	}
+	return all
+}
+
+// clientMsg is a msg sent by a websocket client
+type clientMsg struct {
+	// replaces the filter of the connection; {} removes it
+	Subscribe *matcher `json:"subscribe"`
+}
+
+// handleClientMsg handles msg b sent by the websocket client s. The
+// client is sent {"subscribed": filter} or {"error": "..."} in reply.
+// It returns false if s is no longer connected.
+func handleClientMsg(ws *WS, s *subscriber, b []byte) bool {
+	var msg clientMsg
+	err := json.Unmarshal(b, &msg)
+	if err == nil && msg.Subscribe == nil {
+		err = fmt.Errorf("unknown msg")
+	}
+	if err == nil {
+		err = msg.Subscribe.validate()
+	}
+	if err != nil {
+		r, _ := json.Marshal(struct {
+			Error string `json:"error"`
+		}{err.Error()})
+		return ws.reply(s, r)
+	}
+
+	ws.l.Printf("%s subscribed to %s\n", s.addr, msg.Subscribe)
+	r, _ := json.Marshal(struct {
+		Subscribed *matcher `json:"subscribed"`
+	}{msg.Subscribe})
+	return ws.subscribe(s, msg.Subscribe, r)
+}
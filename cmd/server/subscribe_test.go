@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMatcher(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *matcher // nil if no filter
+		err   bool
+	}{
+		{query: "", want: nil},
+		{query: "last=10", want: nil},
+		{query: "host=db-*&status=1", want: &matcher{Host: "db-*", Status: statuses{1}}},
+		{query: "status=FAILED,RESOLVED&status=0", want: &matcher{Status: statuses{1, 2, 0}}},
+		{query: "severity=CRITICAL,UNKNOWN", want: &matcher{Severity: []string{"CRITICAL", "UNKNOWN"}}},
+		{query: "label=env=prod&label=team=dba", want: &matcher{Labels: map[string]string{"env": "prod", "team": "dba"}}},
+		{query: "status=failed", err: true},
+		{query: "severity=BAD", err: true},
+		{query: "label=env", err: true},
+		{query: "host=[", err: true},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		got, err := parseMatcher(q)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: got error %v, want error %v", tt.query, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSubscriptionFiltering(t *testing.T) {
+	hub := useHub(t)
+	s, _, err := hub.register("test", "/ws/connect", newUser("dev", scopeViewer, "web-*"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscribe := func(msg, want string) {
+		t.Helper()
+		if !handleClientMsg(hub, s, []byte(msg)) {
+			t.Fatalf("%s: subscriber was dropped", msg)
+		}
+		events := received(s)
+		if len(events) != 1 || !strings.Contains(string(events[0].data), want) {
+			t.Fatalf("%s: got %d replies, want one with %q", msg, len(events), want)
+		}
+	}
+	// broadcasts an alert for each of hosts/tasks/statuses and a host msg
+	// about web-2, returning what s got of them
+	broadcast := func() []string {
+		t.Helper()
+		for _, a := range []*msgFormat{
+			{From: "web-1", TaskName: "disk", Status: 1},
+			{From: "web-1", TaskName: "disk", Status: 2},
+			{From: "web-1", TaskName: "cpu", Status: 1},
+			{From: "db-1", TaskName: "disk", Status: 1},
+		} {
+			hub.Broadcast([]byte("alert"), a.From, a)
+		}
+		hub.Broadcast([]byte("host"), "web-2", nil)
+
+		var got []string
+		for _, e := range received(s) {
+			if e.alert == nil {
+				got = append(got, e.host)
+			} else {
+				got = append(got, fmt.Sprintf("%s/%s/%d", e.alert.From, e.alert.TaskName, e.alert.Status))
+			}
+		}
+		return got
+	}
+	check := func(got []string, want ...string) {
+		t.Helper()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	check(broadcast(), "web-1/disk/1", "web-1/disk/2", "web-1/cpu/1", "web-2")
+
+	subscribe(`{"subscribe": {"task": "d*", "status": ["FAILED"]}}`, `"subscribed"`)
+	check(broadcast(), "web-1/disk/1", "web-2")
+
+	// an invalid filter leaves the previous one in place
+	subscribe(`{"subscribe": {"status": ["BOGUS"]}}`, `"error"`)
+	subscribe(`{"subscribe": {"severity": ["BAD"]}}`, `"error"`)
+	subscribe(`{"unsubscribe": {}}`, `"error"`)
+	check(broadcast(), "web-1/disk/1", "web-2")
+
+	subscribe(`{"subscribe": {"host": "web-1", "status": [2]}}`, `"subscribed"`)
+	check(broadcast(), "web-1/disk/2")
+
+	subscribe(`{"subscribe": {}}`, `"subscribed"`)
+	check(broadcast(), "web-1/disk/1", "web-1/disk/2", "web-1/cpu/1", "web-2")
+}
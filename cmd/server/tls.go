@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// pinHostnames is set when clients have to present certificates; the
+// hostname a client sends should then be the CN of its certificate
+var pinHostnames bool
+
+// serverTLS creates the TLS config for the gRPC server from the cert and key
+// files. If caFile is given, clients have to present a certificate signed by it.
+func serverTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pool, err := certPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// certPool reads PEM encoded certificates in file
+func certPool(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// checkHostname checks that the client in ctx is allowed to send msgs as
+// hostname, ie. that it's the CN of its certificate
+func checkHostname(ctx context.Context, hostname string) error {
+	if !pinHostnames {
+		return nil
+	}
+	cn, err := peerCN(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	if cn != hostname {
+		return status.Errorf(codes.PermissionDenied, "certificate of %s cannot be used to send as %s", cn, hostname)
+	}
+	return nil
+}
+
+// peerCN returns the CN of the verified certificate of the client in ctx
+func peerCN(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", errors.New("no peer")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", errors.New("no verified client certificate")
+	}
+	return info.State.VerifiedChains[0][0].Subject.CommonName, nil
+}
+
+// peerAddr returns the address of the client in ctx, for logging
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opxyc/wd/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// testCA signs certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "wd test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert, key, pool, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate for cn signed by ca, with its key, both PEM encoded
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb})
+}
+
+// lockedBuffer is a bytes.Buffer safe for use by the server and the test
+type lockedBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+// useTLSServer starts a gRPC server requiring client certificates signed
+// by ca, set up as main does, and returns its address
+func useTLSServer(t *testing.T, ca *testCA) string {
+	t.Helper()
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, "wd-server", x509.ExtKeyUsageServerAuth)
+	files := map[string][]byte{"server.crt": certPEM, "server.key": keyPEM, "ca.crt": ca.pem}
+	for name, b := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := serverTLS(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinHostnames = true
+	t.Cleanup(func() { pinHostnames = false })
+
+	lsnr, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(cfg)))
+	proto.RegisterWatchdogServer(srv, pbSrv{})
+	go srv.Serve(lsnr)
+	t.Cleanup(srv.Stop)
+	return lsnr.Addr().String()
+}
+
+// dialAs connects to addr with a client certificate for cn signed by ca
+func dialAs(t *testing.T, addr string, serverCA, ca *testCA, cn string) proto.WatchdogClient {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, cn, x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: serverCA.pool})
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return proto.NewWatchdogClient(conn)
+}
+
+func TestHostnamePinnedToCN(t *testing.T) {
+	useStore(t)
+	useHub(t)
+	oldHosts := hosts
+	hosts = map[string]*host{}
+	t.Cleanup(func() { hosts = oldHosts })
+	var auditLog lockedBuffer
+	oldAudit := audit
+	audit = log.New(&auditLog, "", 0)
+	t.Cleanup(func() { audit = oldAudit })
+
+	ca := newTestCA(t)
+	addr := useTLSServer(t, ca)
+	c := dialAs(t, addr, ca, ca, "db-1")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	heartbeat := func(c proto.WatchdogClient, hostname string) error {
+		_, err := c.SendHeartbeat(ctx, &proto.Heartbeat{Hostname: hostname, Interval: 60})
+		return err
+	}
+
+	if err := heartbeat(c, "db-1"); err != nil {
+		t.Fatalf("heartbeat as the CN of the certificate: %v", err)
+	}
+	hostsMu.Lock()
+	_, ok := hosts["db-1"]
+	hostsMu.Unlock()
+	if !ok {
+		t.Error("heartbeat as db-1 was accepted but db-1 is not known")
+	}
+	if s := auditLog.String(); s != "" {
+		t.Errorf("accepted heartbeat was audited as %q", s)
+	}
+
+	err := heartbeat(c, "db-2")
+	if code := status.Code(err); code != codes.PermissionDenied {
+		t.Fatalf("heartbeat as another host: got %v, want %v", err, codes.PermissionDenied)
+	}
+	hostsMu.Lock()
+	_, ok = hosts["db-2"]
+	hostsMu.Unlock()
+	if ok {
+		t.Error("rejected heartbeat added db-2")
+	}
+	s := auditLog.String()
+	if !strings.Contains(s, `rejected SendHeartbeat as "db-2"`) || !strings.Contains(s, "certificate of db-1") {
+		t.Errorf("audit log has %q, want the rejection of db-1 sending as db-2", s)
+	}
+
+	// certificates not signed by the CA do not get as far as checkHostname
+	other := dialAs(t, addr, ca, newTestCA(t), "db-2")
+	if err := heartbeat(other, "db-2"); err == nil {
+		t.Error("heartbeat with a certificate from another CA was accepted")
+	}
+}
+
+func TestCheckHostnameNeedsVerifiedCert(t *testing.T) {
+	pinHostnames = true
+	defer func() { pinHostnames = false }()
+	if code := status.Code(checkHostname(context.Background(), "db-1")); code != codes.Unauthenticated {
+		t.Errorf("got %v without a peer, want %v", code, codes.Unauthenticated)
+	}
+}
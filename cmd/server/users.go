@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scopes of users, each allowing what the ones before it do
+const (
+	scopeViewer       = "viewer"       // see alerts, hosts and silences
+	scopeAcknowledger = "acknowledger" // acknowledge, assign and resolve alerts
+	scopeAdmin        = "admin"        // manage silences and hosts
+)
+
+var scopeLevels = map[string]int{scopeViewer: 1, scopeAcknowledger: 2, scopeAdmin: 3}
+
+const (
+	sessionCookie = "wd_session"
+	sessionTTL    = 12 * time.Hour
+)
+
+// user is someone who uses the HTTP API or a websocket connection.
+// Hosts of the token are those whose alerts the user can see.
+type user struct {
+	token
+	Scope string `json:"scope"`
+}
+
+type session struct {
+	u       *user
+	expires time.Time
+}
+
+type userKey struct{}
+
+var (
+	// users from config; nil if the API is open to everyone
+	users []*user
+	// origins from which websocket connections are accepted; see checkOrigin
+	allowedOrigins []string
+
+	sessionsMu sync.Mutex
+	sessions   = map[string]*session{} // session ID -> session
+)
+
+// validateUsers checks the users in us
+func validateUsers(us []*user) error {
+	names := map[string]bool{}
+	for i, u := range us {
+		if err := u.init(); err != nil {
+			return fmt.Errorf("user %d: %v", i+1, err)
+		}
+		if names[u.Name] {
+			return fmt.Errorf("user %q: duplicate name", u.Name)
+		}
+		names[u.Name] = true
+		if scopeLevels[u.Scope] == 0 {
+			return fmt.Errorf("user %q: invalid scope %q", u.Name, u.Scope)
+		}
+	}
+	return nil
+}
+
+// can reports whether u has the given scope. A nil user can do
+// anything; that's when no users are configured.
+func (u *user) can(scope string) bool {
+	return u == nil || scopeLevels[u.Scope] >= scopeLevels[scope]
+}
+
+// canSee reports whether u can see the alerts of host
+func (u *user) canSee(host string) bool {
+	return u == nil || u.allows(host)
+}
+
+// seesAll reports whether u can see the alerts of all hosts
+func (u *user) seesAll() bool {
+	return u == nil || containsStr(u.Hosts, "*")
+}
+
+// covers reports whether all hosts matching the glob pattern are hosts u
+// can see; that is, pattern is one of u's own, or a single host u can see.
+// Empty pattern matches all hosts.
+func (u *user) covers(pattern string) bool {
+	switch {
+	case u.seesAll():
+		return true
+	case pattern == "":
+		return false
+	case containsStr(u.Hosts, pattern):
+		return true
+	}
+	return !strings.ContainsAny(pattern, `*?[\`) && u.canSee(pattern)
+}
+
+// findUser returns the user with given name, or nil if there is none
+func findUser(name string) *user {
+	for _, u := range users {
+		if u.Name == name {
+			return u
+		}
+	}
+	return nil
+}
+
+// userFrom returns the user who made r; nil if users are not configured
+func userFrom(r *http.Request) *user {
+	u, _ := r.Context().Value(userKey{}).(*user)
+	return u
+}
+
+// authorized wraps h so that it is served only to users with readScope
+// for GET requests and writeScope for other methods. The user is kept in
+// the request context; see userFrom.
+func authorized(readScope, writeScope string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if users == nil {
+			h.ServeHTTP(rw, r)
+			return
+		}
+
+		u := authenticateUser(r)
+		if u == nil {
+			audit.Printf("rejected %s %s from %s: not authenticated\n", r.Method, r.URL.Path, r.RemoteAddr)
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(rw, "not authenticated", http.StatusUnauthorized)
+			return
+		}
+		scope := writeScope
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = readScope
+		}
+		if !u.can(scope) {
+			audit.Printf("rejected %s %s from %s: user %s is not %s\n", r.Method, r.URL.Path, r.RemoteAddr, u.Name, scope)
+			http.Error(rw, fmt.Sprintf("needs scope %s", scope), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), userKey{}, u)))
+	})
+}
+
+// authenticateUser finds the user by the bearer token or session cookie in r
+func authenticateUser(r *http.Request) *user {
+	if s := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); s != "" {
+		for _, u := range users {
+			if !u.Revoked && u.matches(s) {
+				return u
+			}
+		}
+		return nil
+	}
+
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[c.Value]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(s.expires) {
+		delete(sessions, c.Value)
+		return nil
+	}
+	return s.u
+}
+
+// sessionHandler handles:
+//
+//	POST   /session - starts a session for the user of the bearer token, setting a cookie
+//	DELETE /session - ends the session
+func sessionHandler(r *http.Request) (interface{}, error) {
+	u := userFrom(r)
+	if u == nil {
+		return nil, &apiError{http.StatusNotFound, "users are not configured"}
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		id := hex.EncodeToString(b)
+		expires := time.Now().Add(sessionTTL)
+
+		sessionsMu.Lock()
+		// drop expired ones while at it
+		for k, s := range sessions {
+			if time.Now().After(s.expires) {
+				delete(sessions, k)
+			}
+		}
+		sessions[id] = &session{u: u, expires: expires}
+		sessionsMu.Unlock()
+
+		l.Printf("session started for user %s from %s\n", u.Name, r.RemoteAddr)
+		return &setCookie{&http.Cookie{
+			Name:     sessionCookie,
+			Value:    id,
+			Path:     "/",
+			Expires:  expires,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		}, map[string]interface{}{"user": u.Name, "scope": u.Scope, "expires": expires}}, nil
+	case http.MethodDelete:
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			sessionsMu.Lock()
+			delete(sessions, c.Value)
+			sessionsMu.Unlock()
+		}
+		return &setCookie{&http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1}, struct{}{}}, nil
+	}
+	return nil, errMethod(r.Method)
+}
+
+// setCookie is a response that sets a cookie along with writing v
+type setCookie struct {
+	c *http.Cookie
+	v interface{}
+}
+
+// checkOrigin accepts websocket connections from allowedOrigins only, if
+// they're configured. Otherwise, connections from any origin are accepted
+// if the API is open to everyone, and only from the same origin if there
+// are users, so that another site cannot connect with their session.
+func checkOrigin(r *http.Request) bool {
+	if len(allowedOrigins) == 0 && users == nil {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not a browser
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if len(allowedOrigins) == 0 {
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		audit.Printf("rejected websocket connection from %s: origin %s is not %s\n", r.RemoteAddr, origin, r.Host)
+		return false
+	}
+	for _, o := range allowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) || strings.EqualFold(o, u.Host) {
+			return true
+		}
+	}
+	audit.Printf("rejected websocket connection from %s: origin %s not allowed\n", r.RemoteAddr, origin)
+	return false
+}
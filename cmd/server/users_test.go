@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useUsers configures users for the duration of the test
+func useUsers(t *testing.T, us ...*user) {
+	t.Helper()
+	if err := validateUsers(us); err != nil {
+		t.Fatal(err)
+	}
+	users = us
+	t.Cleanup(func() { users = nil })
+}
+
+func newUser(name, scope string, hosts ...string) *user {
+	return &user{token: token{Name: name, Token: name + "-token", Hosts: hosts}, Scope: scope}
+}
+
+// asUser returns r as made by u, as authorized would
+func asUser(r *http.Request, u *user) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, u))
+}
+
+func TestAuthorized(t *testing.T) {
+	ok := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(userFrom(r).Name))
+	})
+	h := authorized(scopeViewer, scopeAdmin, ok)
+	useUsers(t, newUser("viewer", scopeViewer, "*"), newUser("admin", scopeAdmin, "*"))
+
+	tests := []struct {
+		method, token string
+		want          int
+	}{
+		{http.MethodGet, "", http.StatusUnauthorized},
+		{http.MethodGet, "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "viewer-token", http.StatusOK},
+		{http.MethodPost, "viewer-token", http.StatusForbidden},
+		{http.MethodPost, "admin-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/silences", nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, r)
+		if rw.Code != tt.want {
+			t.Errorf("%s with %q: got %d, want %d", tt.method, tt.token, rw.Code, tt.want)
+		}
+	}
+}
+
+func TestUserCovers(t *testing.T) {
+	u := newUser("dba", scopeAdmin, "db-*", "backup-1")
+	if err := u.init(); err != nil {
+		t.Fatal(err)
+	}
+	for pattern, want := range map[string]bool{
+		"db-*":     true,
+		"db-1":     true,
+		"backup-1": true,
+		"":         false,
+		"*":        false,
+		"d*":       false,
+		"web-1":    false,
+	} {
+		if got := u.covers(pattern); got != want {
+			t.Errorf("covers(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+	var nobody *user
+	if !nobody.covers("") {
+		t.Error("no user (users not configured) should cover all hosts")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	req := func(origin string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://wd.example.com/ws/connect", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+	tests := []struct {
+		users   bool
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{false, nil, "https://evil.example.com", true},
+		{true, nil, "https://evil.example.com", false},
+		{true, nil, "https://wd.example.com", true},
+		{true, nil, "", true},
+		{true, []string{"wdc.example.com"}, "https://wdc.example.com", true},
+		{true, []string{"wdc.example.com"}, "https://wd.example.com", false},
+		{false, []string{"https://wdc.example.com"}, "https://evil.example.com", false},
+		{true, []string{"*"}, "https://evil.example.com", true},
+	}
+	defer func() { users, allowedOrigins = nil, nil }()
+	for _, tt := range tests {
+		users = nil
+		if tt.users {
+			users = []*user{newUser("ops", scopeAdmin)}
+		}
+		allowedOrigins = tt.allowed
+		if got := checkOrigin(req(tt.origin)); got != tt.want {
+			t.Errorf("users %v, allowed %v, origin %q: got %v, want %v", tt.users, tt.allowed, tt.origin, got, tt.want)
+		}
+	}
+}
@@ -1,52 +1,213 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+const (
+	// max number of connections handled at a time
+	maxConns = 1000
+	// number of msgs that can be queued for a connection. If a connection
+	// falls behind by more than this, it is disconnected.
+	sendQueueSize = 256
+	// time allowed to write a msg to a connection
+	writeWait = 10 * time.Second
+	// time allowed to read the next pong from a connection
+	pongWait = 60 * time.Second
+	// pings are sent at this interval; must be less than pongWait
+	pingPeriod = pongWait * 9 / 10
+	// max size of a msg that can be read from a connection
+	maxReadSize = 4096
+	// number of recent msgs kept so that subscribers can resume from
+	// where they left off (see /events and /alerts/wait)
+	eventBufferSize = 1000
+)
+
 var (
 	upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		CheckOrigin: checkOrigin,
 	}
+
+	errTooManyConns = errors.New("too many connections")
 )
 
-// WS is websocket handle
+// WS is websocket handle. It's also the hub through which msgs are
+// broadcast to SSE and long-poll clients.
 type WS struct {
 	// address of ws
 	addr string
 	// the endpoint on which nodes should hit to make connection
 	ep string
-	// map of conn info (of connected nodes)
-	cons map[string]websocket.Conn
+	mu sync.Mutex
+	// connected subscribers
+	cons map[*subscriber]struct{}
 	l    *log.Logger
+	// sequence number of the last msg broadcast
+	seq uint64
+	// last eventBufferSize msgs broadcast, oldest first
+	buf []*event
+}
+
+// event is a msg broadcast through ws
+type event struct {
+	seq  uint64
+	data []byte
+	host string // host the msg is about
+	// alert the msg is about; nil if it's not about an alert
+	alert *msgFormat
+}
+
+// subscriber is anything that receives broadcasted msgs, eg. a websocket
+// connection, an SSE stream or a long-poll request
+type subscriber struct {
+	// remote address and the endpoint it subscribed on; used only for logging
+	addr, ep string
+	// msgs to be sent. closed when subscriber is removed from ws.
+	send chan *event
+	// who subscribed; only msgs about hosts the user can see are sent
+	user *user
+	// only alerts matching it are sent, if not nil. Changed only with ws.mu held.
+	filter *matcher
+}
+
+// wants reports whether e is to be sent to s. Msgs that are not about an
+// alert are matched only by the host in s.filter.
+func (s *subscriber) wants(e *event) bool {
+	if !s.user.canSee(e.host) {
+		return false
+	}
+	if s.filter == nil {
+		return true
+	}
+	if e.alert == nil {
+		return globMatch(s.filter.Host, e.host)
+	}
+	return s.filter.match(e.alert)
 }
 
 // Start starts the websocket server and listens on ws.ep
 func (ws *WS) Start() error {
-	http.Handle(ws.ep, connectHandler(ws, connect))
+	http.Handle(ws.ep, authorized(scopeViewer, scopeViewer, connectHandler(ws, connect)))
 	return http.ListenAndServe(ws.addr, nil)
 }
 
-// Broadcast broadcasts a given msg to all the connections in ws
-func (ws *WS) Broadcast(msg []byte) {
-	failedCons := []string{}
-	for _, c := range ws.cons {
-		err := c.WriteMessage(websocket.TextMessage, msg)
-		if err != nil {
-			ws.l.Printf("failed to send msg to socket %s: %v\n", c.RemoteAddr().String(), err)
-			failedCons = append(failedCons, c.RemoteAddr().String())
+// Broadcast broadcasts a given msg about host (and alert a, if it's about
+// one) to all the connections in ws whose users can see host and whose
+// filters match. It does not wait for msg to be written.
+// Connections that are not keeping up are disconnected.
+func (ws *WS) Broadcast(msg []byte, host string, a *msgFormat) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.seq++
+	e := &event{seq: ws.seq, data: msg, host: host, alert: a}
+	if len(ws.buf) >= eventBufferSize {
+		ws.buf = ws.buf[1:]
+	}
+	ws.buf = append(ws.buf, e)
+
+	for s := range ws.cons {
+		if s.wants(e) {
+			ws.queue(s, e)
+		}
+	}
+}
+
+// queue queues e to be sent to s, disconnecting s if its queue is full.
+// It returns false if s is not (or no longer) in ws. ws.mu must be held.
+func (ws *WS) queue(s *subscriber, e *event) bool {
+	if _, ok := ws.cons[s]; !ok {
+		return false
+	}
+	select {
+	case s.send <- e:
+		return true
+	default:
+		ws.l.Printf("send queue of %s is full, disconnecting\n", s.addr)
+		ws.remove(s)
+		return false
+	}
+}
+
+// since returns the msgs broadcast after the one with sequence number seq
+// that s wants. ok is false if some of them are no longer kept.
+func (ws *WS) since(seq uint64, s *subscriber) (events []*event, ok bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if seq > ws.seq {
+		return nil, false
+	}
+	if len(ws.buf) > 0 && seq+1 < ws.buf[0].seq {
+		return nil, false
+	}
+	for _, e := range ws.buf {
+		if e.seq > seq && s.wants(e) {
+			events = append(events, e)
 		}
 	}
+	return events, true
+}
+
+// subscribe sets the filter of s to m and queues reply to be sent to s
+// before any msg matching m. It returns false if s is no longer in ws.
+func (ws *WS) subscribe(s *subscriber, m *matcher, reply []byte) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if _, ok := ws.cons[s]; !ok {
+		return false
+	}
+	s.filter = m
+	return ws.queue(s, &event{data: reply})
+}
+
+// reply queues msg, which is not broadcast, to be sent to s.
+// It returns false if s is no longer in ws.
+func (ws *WS) reply(s *subscriber, msg []byte) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.queue(s, &event{data: msg})
+}
+
+// register adds a new subscriber to ws, sending it only alerts matching
+// filter, if it's not nil. seq is the sequence number of the last msg
+// broadcast before s was added; all msgs after it are sent to s.
+func (ws *WS) register(addr, ep string, u *user, filter *matcher) (s *subscriber, seq uint64, err error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if len(ws.cons) >= maxConns {
+		return nil, 0, errTooManyConns
+	}
+	s = &subscriber{addr: addr, ep: ep, send: make(chan *event, sendQueueSize), user: u, filter: filter}
+	ws.cons[s] = struct{}{}
+	ws.l.Printf("new connection %s added on %+v%v :: total: %d\n", addr, ws.addr, ep, len(ws.cons))
+	return s, ws.seq, nil
+}
 
-	for _, rAddr := range failedCons {
-		delete(ws.cons, rAddr)
-		ws.l.Printf("removed connection %s from %s%s\n", rAddr, ws.addr, ws.ep)
+// unregister removes s from ws, if it's not removed already
+func (ws *WS) unregister(s *subscriber) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.remove(s)
+}
+
+// remove removes s from ws. ws.mu must be held.
+func (ws *WS) remove(s *subscriber) {
+	if _, ok := ws.cons[s]; !ok {
+		return
 	}
+	delete(ws.cons, s)
+	close(s.send)
+	ws.l.Printf("removed connection %s from %s%s :: total: %d\n", s.addr, ws.addr, s.ep, len(ws.cons))
 }
 
 // New creates a new websocket handle
@@ -54,16 +215,13 @@ func New(addr, ep string, l *log.Logger) *WS {
 	return &WS{
 		addr: addr,
 		ep:   ep,
-		cons: make(map[string]websocket.Conn, 1000),
+		cons: make(map[*subscriber]struct{}, maxConns),
 		l:    l,
 	}
 }
 
-// websocketServer creates a websocket server and listens for incoming
-// connections. It also assigns a handle to the global var ws
-// which can be used to broadcast messages to ws connections.
-func websocketServer(addr, ep string, l *log.Logger) {
-	ws = New(addr, ep, l)
+// websocketServer starts ws and listens for incoming connections
+func websocketServer(ws *WS) {
 	log.Printf("http listening on %v\n", ws.addr)
 	ws.l.Fatal(ws.Start())
 }
@@ -72,6 +230,15 @@ func websocketServer(addr, ep string, l *log.Logger) {
 func connectHandler(ws *WS, f func(ws *WS, rw http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
 		err := f(ws, rw, r)
+		if err == errTooManyConns {
+			http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+			ws.l.Printf("rejected connection from %s: %v", r.RemoteAddr, err)
+			return
+		}
+		if e, ok := err.(*apiError); ok {
+			http.Error(rw, e.msg, e.code)
+			return
+		}
 		if err != nil {
 			http.Error(rw, err.Error(), http.StatusInternalServerError)
 			ws.l.Printf("error handling %v:%v", r.RequestURI, err)
@@ -80,22 +247,113 @@ func connectHandler(ws *WS, f func(ws *WS, rw http.ResponseWriter, r *http.Reque
 }
 
 func connect(ws *WS, rw http.ResponseWriter, r *http.Request) error {
+	filter, err := parseMatcher(r.URL.Query())
+	if err != nil {
+		return &apiError{http.StatusBadRequest, err.Error()}
+	}
+
+	// register before looking up the alerts to be replayed, so that
+	// nothing received in between is missed
+	s, _, err := ws.register(r.RemoteAddr, ws.ep, userFrom(r), filter)
+	if err != nil {
+		return err
+	}
+
+	// alerts the client missed, if it asked for them
+	missed, reset, err := replayAlerts(r.URL.Query(), s.user, filter)
+	if err != nil {
+		ws.unregister(s)
+		return err
+	}
+
 	c, err := upgrader.Upgrade(rw, r, nil)
 	if err != nil {
+		ws.unregister(s)
 		log.Print("upgrade:", err)
 		return nil
 	}
 	defer c.Close()
 
-	ws.cons[r.RemoteAddr] = *c
-	ws.l.Printf("new connection %s added on %+v%v :: total: %d\n", r.RemoteAddr, ws.addr, ws.ep, len(ws.cons))
+	go writePump(ws, s, c, missed, reset)
 
+	// read subscribe msgs; reading also gets pongs and close msgs processed
+	c.SetReadLimit(maxReadSize)
+	c.SetReadDeadline(time.Now().Add(pongWait))
+	c.SetPongHandler(func(string) error {
+		return c.SetReadDeadline(time.Now().Add(pongWait))
+	})
 	for {
-		_, _, err := c.ReadMessage()
+		_, b, err := c.ReadMessage()
 		if err != nil {
-			log.Println(err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				ws.l.Printf("error reading from %s: %v\n", s.addr, err)
+			}
+			break
+		}
+		if !handleClientMsg(ws, s, b) {
 			break
 		}
 	}
+	ws.unregister(s)
 	return nil
 }
+
+// writePump writes the missed alerts, preceded by {"reset": true} if reset
+// is set, and then the msgs queued for s to c. It is the only goroutine
+// that writes to c.
+func writePump(ws *WS, s *subscriber, c *websocket.Conn, missed []*storedAlert, reset bool) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		// unblocks the reader in connect, if it's still reading
+		c.Close()
+	}()
+
+	write := func(msgType int, b []byte) error {
+		c.SetWriteDeadline(time.Now().Add(writeWait))
+		return c.WriteMessage(msgType, b)
+	}
+
+	if reset {
+		if err := write(websocket.TextMessage, []byte(`{"reset": true}`)); err != nil {
+			ws.l.Printf("failed to replay alerts to socket %s: %v\n", s.addr, err)
+			ws.unregister(s)
+			return
+		}
+	}
+	for _, a := range missed {
+		m := a.msgFormat
+		m.Replay = true
+		b, err := json.Marshal(m)
+		if err != nil {
+			ws.l.Printf("failed to marshal msg: %v", err)
+			continue
+		}
+		if err := write(websocket.TextMessage, b); err != nil {
+			ws.l.Printf("failed to replay alerts to socket %s: %v\n", s.addr, err)
+			ws.unregister(s)
+			return
+		}
+	}
+
+	for {
+		select {
+		case e, ok := <-s.send:
+			if !ok {
+				// removed from ws
+				write(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := write(websocket.TextMessage, e.data); err != nil {
+				ws.l.Printf("failed to send msg to socket %s: %v\n", s.addr, err)
+				ws.unregister(s)
+				return
+			}
+		case <-ticker.C:
+			if err := write(websocket.PingMessage, nil); err != nil {
+				ws.unregister(s)
+				return
+			}
+		}
+	}
+}
@@ -21,4 +21,6 @@ require (
 require (
 	github.com/lithammer/shortuuid v3.0.0+incompatible
 	github.com/opxyc/goutils v0.0.0-20211027051832-245e5ab40e2a
+	github.com/robfig/cron/v3 v3.0.1
+	go.etcd.io/bbolt v1.3.6
 )
@@ -19,6 +19,10 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type WatchdogClient interface {
 	SendAlert(ctx context.Context, in *Alert, opts ...grpc.CallOption) (*Void, error)
+	// sent by clients at regular intervals to let the server know they are alive
+	SendHeartbeat(ctx context.Context, in *Heartbeat, opts ...grpc.CallOption) (*Void, error)
+	// results of task runs, passed or failed; sent in batches
+	SendResults(ctx context.Context, in *Results, opts ...grpc.CallOption) (*Void, error)
 }
 
 type watchdogClient struct {
@@ -38,11 +42,33 @@ func (c *watchdogClient) SendAlert(ctx context.Context, in *Alert, opts ...grpc.
 	return out, nil
 }
 
+func (c *watchdogClient) SendHeartbeat(ctx context.Context, in *Heartbeat, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := c.cc.Invoke(ctx, "/proto.watchdog/SendHeartbeat", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *watchdogClient) SendResults(ctx context.Context, in *Results, opts ...grpc.CallOption) (*Void, error) {
+	out := new(Void)
+	err := c.cc.Invoke(ctx, "/proto.watchdog/SendResults", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // WatchdogServer is the server API for Watchdog service.
 // All implementations must embed UnimplementedWatchdogServer
 // for forward compatibility
 type WatchdogServer interface {
 	SendAlert(context.Context, *Alert) (*Void, error)
+	// sent by clients at regular intervals to let the server know they are alive
+	SendHeartbeat(context.Context, *Heartbeat) (*Void, error)
+	// results of task runs, passed or failed; sent in batches
+	SendResults(context.Context, *Results) (*Void, error)
 	// mustEmbedUnimplementedWatchdogServer()
 }
 
@@ -53,6 +79,12 @@ type UnimplementedWatchdogServer struct {
 func (UnimplementedWatchdogServer) SendAlert(context.Context, *Alert) (*Void, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendAlert not implemented")
 }
+func (UnimplementedWatchdogServer) SendHeartbeat(context.Context, *Heartbeat) (*Void, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendHeartbeat not implemented")
+}
+func (UnimplementedWatchdogServer) SendResults(context.Context, *Results) (*Void, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendResults not implemented")
+}
 func (UnimplementedWatchdogServer) mustEmbedUnimplementedWatchdogServer() {}
 
 // UnsafeWatchdogServer may be embedded to opt out of forward compatibility for this service.
@@ -84,6 +116,42 @@ func _Watchdog_SendAlert_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Watchdog_SendHeartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Heartbeat)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WatchdogServer).SendHeartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.watchdog/SendHeartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WatchdogServer).SendHeartbeat(ctx, req.(*Heartbeat))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Watchdog_SendResults_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Results)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WatchdogServer).SendResults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.watchdog/SendResults",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WatchdogServer).SendResults(ctx, req.(*Results))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Watchdog_ServiceDesc is the grpc.ServiceDesc for Watchdog service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -95,6 +163,14 @@ var Watchdog_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendAlert",
 			Handler:    _Watchdog_SendAlert_Handler,
 		},
+		{
+			MethodName: "SendHeartbeat",
+			Handler:    _Watchdog_SendHeartbeat_Handler,
+		},
+		{
+			MethodName: "SendResults",
+			Handler:    _Watchdog_SendResults_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "alert.proto",